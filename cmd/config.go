@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"soil/deploy"
+)
+
+// CONFIG_FILE is the name of user config file in soil home,
+// and of project config file in the current or a parent directory.
+const CONFIG_FILE = "soil.yaml"
+
+// configKeys are settings taken from flags, SOIL_* environment variables,
+// project config and user config, in the order of precedence.
+var configKeys = []string{
+	"type",
+	"terraform-repo-ref",
+	"terraform-work-dir",
+	"terraform-var-file",
+	"replicas",
+	"rancher-version",
+	"cert-manager-version",
+	"grafana-version",
+	"monitoring-version",
+}
+
+// projectConfigFile returns the closest soil.yaml in dir or its parents.
+func projectConfigFile(dir string) string {
+	for {
+		path := filepath.Join(dir, CONFIG_FILE)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// readConfig reads user config from soil home merged with project config.
+func readConfig() (*viper.Viper, error) {
+	v := viper.New()
+	v.SetEnvPrefix("SOIL")
+	v.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
+	v.AutomaticEnv()
+
+	files := []string{}
+	user := filepath.Join(deploy.SoilHome(), CONFIG_FILE)
+	if _, err := os.Stat(user); err == nil {
+		files = append(files, user)
+	}
+	if cwd, err := os.Getwd(); err == nil {
+		if project := projectConfigFile(cwd); project != "" && project != user {
+			files = append(files, project)
+		}
+	}
+	for _, f := range files {
+		log.Printf("Reading config file: %s", f)
+		v.SetConfigFile(f)
+		if err := v.MergeInConfig(); err != nil {
+			return nil, fmt.Errorf("Invalid config file '%s': %w", f, err)
+		}
+	}
+	return v, nil
+}
+
+// applyConfig sets flags of the command not given on command line
+// from environment and config files.
+func applyConfig(cmd *cobra.Command) error {
+	v, err := readConfig()
+	if err != nil {
+		return err
+	}
+	for _, key := range configKeys {
+		if !v.IsSet(key) {
+			continue
+		}
+		f := cmd.Flags().Lookup(key)
+		if f == nil || f.Changed {
+			continue
+		}
+		if err := f.Value.Set(v.GetString(key)); err != nil {
+			return fmt.Errorf("Invalid config value of '%s': %w", key, err)
+		}
+	}
+	return nil
+}
@@ -5,35 +5,137 @@ import (
 
 	"github.com/spf13/cobra"
 	"soil/deploy"
+	"soil/util"
 )
 
 func init() {
 	rootCmd.AddCommand(deployCmd)
 }
 
+// chartVersionFlags maps flags to charts of the versions.
+var chartVersionFlags = map[string]string{
+	"rancher-version":      "rancher",
+	"cert-manager-version": "cert-manager",
+	"grafana-version":      "grafana",
+	"monitoring-version":   "rancher-monitoring",
+}
+
+func setSoilfileChart(sf *deploy.Soilfile, name string, set func(*deploy.Chart)) {
+	if sf.Charts == nil {
+		sf.Charts = map[string]deploy.Chart{}
+	}
+	c := sf.Charts[name]
+	set(&c)
+	sf.Charts[name] = c
+}
+
+// loadSoilfile reads and validates the Soilfile, options given
+// on command line override the Soilfile.
+func loadSoilfile(cmd *cobra.Command) (*deploy.Soilfile, error) {
+	sf, err := deploy.LoadSoilfile(Soilfile)
+	if err != nil {
+		return nil, err
+	}
+	flags := cmd.Flags()
+	if flags.Changed("type") || sf.Kind == "" {
+		sf.Kind = DeploymentType
+	}
+	if flags.Changed("terraform-repo-ref") {
+		sf.Terraform.Repo = deploy.TerraformRepoRef
+	}
+	if flags.Changed("terraform-work-dir") {
+		sf.Terraform.WorkDir = deploy.TerraformWorkDir
+	}
+	if flags.Changed("terraform-var-file") {
+		sf.Terraform.VarFile = deploy.TerraformVarFile
+	}
+	if flags.Changed("replicas") {
+		sf.Replicas = deploy.RancherReplicas
+	}
+	charts := map[string]string{}
+	for flag, name := range chartVersionFlags {
+		if flags.Changed(flag) {
+			charts[name], _ = flags.GetString(flag)
+		}
+	}
+	for name, version := range charts {
+		setSoilfileChart(sf, name, func(c *deploy.Chart) { c.Version = version })
+	}
+	if flags.Changed("chart") {
+		for name, url := range deploy.ChartURLs {
+			setSoilfileChart(sf, name, func(c *deploy.Chart) { c.URL = url })
+		}
+	}
+	return sf, sf.Validate(Soilfile)
+}
+
 var deployCmd = &cobra.Command{
 	Use:     "deploy [NAME]",
 	Aliases: []string{"dp", "make", "mk"},
 	Short:   "Create deployment under given name",
 	Args:    cobra.MaximumNArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var sf *deploy.Soilfile
+		if Soilfile != "" {
+			var err error
+			if sf, err = loadSoilfile(cmd); err != nil {
+				return err
+			}
+		}
+		ctx, cancel := commandContext()
+		defer cancel()
 		kind := DeploymentType
 		name := "default"
 		if len(args) > 0 {
 			name = args[0]
+		} else if sf != nil && sf.Name != "" {
+			name = sf.Name
+		}
+		unlock, err := deploy.LockDeployment(ctx, name, cmd.Name())
+		if err != nil {
+			return commandError(ctx, err)
 		}
-		fmt.Printf("Deploying %s as %s...\n", kind, name)
-		k := deploy.KindMap[kind]
-		if deploy.TerraformVarFile != "" {
-			k.TerraformVarFile = deploy.TerraformVarFile
+		defer unlock()
+		var d deploy.Deployment
+		if deploy.Resume || deploy.FromPhase != "" || deploy.OnlyPhase != "" {
+			d, err = deploy.LookupDeployment(name)
+			if err != nil {
+				return err
+			}
+			if _, err := deploy.SelectPhases(nil, deploy.Resume, deploy.FromPhase, deploy.OnlyPhase); err != nil {
+				return err
+			}
+			fmt.Printf("Continuing deployment %s...\n", d.DName())
+		} else if sf != nil {
+			fmt.Printf("Deploying %s as %s from %s...\n", sf.Kind, name, Soilfile)
+			if d, err = deploy.MakeSoilfileDeployment(name, sf); err != nil {
+				return err
+			}
+		} else {
+			fmt.Printf("Deploying %s as %s...\n", kind, name)
+			k, err := deploy.LookupKind(kind)
+			if err != nil {
+				return err
+			}
+			if deploy.TerraformVarFile != "" {
+				k.TerraformVarFile = deploy.TerraformVarFile
+			}
+			if deploy.TerraformWorkDir != "" {
+				k.TerraformWorkDir = deploy.TerraformWorkDir
+			}
+			k.TerraformRepoRef = deploy.TerraformRepoRef
+			if d, err = deploy.MakeDeployment(name, k); err != nil {
+				return err
+			}
 		}
-		if deploy.TerraformWorkDir != "" {
-			k.TerraformWorkDir = deploy.TerraformWorkDir
+		if !util.DryRun && !d.CheckRequirements(ctx) {
+			return errRequirements
 		}
-		k.TerraformRepoRef = deploy.TerraformRepoRef
-		d := deploy.MakeDeployment(name, k)
-		if d.CheckRequirements() {
-			fmt.Printf("Created %s\n", d.Make())
+		path, err := d.Make(ctx)
+		if err != nil {
+			return commandError(ctx, err)
 		}
+		fmt.Printf("Created %s\n", path)
+		return nil
 	},
 }
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"soil/deploy"
+)
+
+// Exit codes of so, CI jobs may rely on them.
+const (
+	ExitFailure      = 1
+	ExitRequirements = 3
+	ExitNotFound     = 4
+	ExitStepFailed   = 5
+	ExitBusy         = 6
+	ExitThresholds   = 7
+	ExitRegression   = 8
+	ExitTimeout      = 124
+	ExitInterrupted  = 130
+)
+
+var errRequirements = errors.New("Requirements are not met")
+
+// commandError makes err report the cancellation, if ctx is cancelled,
+// since commands killed on cancellation fail with their own errors.
+func commandError(ctx context.Context, err error) error {
+	if err == nil || ctx.Err() == nil || errors.Is(err, ctx.Err()) {
+		return err
+	}
+	return fmt.Errorf("%w: %v", ctx.Err(), err)
+}
+
+func exitCode(err error) int {
+	var stepErr *deploy.StepError
+	var busyErr *deploy.BusyError
+	var thresholdsErr *deploy.ThresholdsError
+	var regressionErr *deploy.RegressionError
+	var preflightErr *deploy.PreflightError
+	switch {
+	case errors.Is(err, context.Canceled):
+		return ExitInterrupted
+	case errors.Is(err, context.DeadlineExceeded):
+		return ExitTimeout
+	case errors.Is(err, errRequirements), errors.As(err, &preflightErr):
+		return ExitRequirements
+	case errors.Is(err, deploy.ErrNotFound):
+		return ExitNotFound
+	case errors.As(err, &busyErr):
+		return ExitBusy
+	case errors.As(err, &thresholdsErr):
+		return ExitThresholds
+	case errors.As(err, &regressionErr):
+		return ExitRegression
+	case errors.As(err, &stepErr):
+		return ExitStepFailed
+	}
+	return ExitFailure
+}
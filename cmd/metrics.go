@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"soil/deploy"
+)
+
+var Metrics deploy.MetricsOptions
+var MetricsOutput string
+
+func init() {
+	rootCmd.AddCommand(metricsCmd)
+	metricsCmd.Flags().StringVar(&Metrics.Run, "run", "", "Test run of the time window, the latest one by default")
+	metricsCmd.Flags().DurationVar(&Metrics.Since, "since", 0, "Time window ending now instead of a test run, e.g. 30m")
+	metricsCmd.MarkFlagsMutuallyExclusive("run", "since")
+	metricsCmd.Flags().BoolVar(&Metrics.PortForward, "port-forward", false,
+		"Reach mimir by kubectl port-forward instead of the tester ingress")
+	metricsCmd.Flags().StringToStringVar(&Metrics.Queries, "query", nil,
+		"Additional PromQL query, NAME=QUERY, $window is replaced by the window length")
+	metricsCmd.Flags().StringVarP(&MetricsOutput, "output", "o", "", "Output format, one of: json, yaml")
+}
+
+var metricsCmd = &cobra.Command{
+	Use:   "metrics [NAME]",
+	Short: "Print key metrics of a test run recorded in mimir",
+	Args:  cobra.MaximumNArgs(1),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		switch MetricsOutput {
+		case "", "json", "yaml":
+			return nil
+		}
+		return fmt.Errorf("Unknown output format '%s', expected one of: json, yaml", MetricsOutput)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := "default"
+		if len(args) > 0 {
+			name = args[0]
+		}
+		ctx, cancel := commandContext()
+		defer cancel()
+		d, err := deploy.LookupDeployment(name)
+		if err != nil {
+			return err
+		}
+		report, err := d.Metrics(ctx, Metrics)
+		if err != nil {
+			return commandError(ctx, err)
+		}
+		if MetricsOutput != "" {
+			return printStructured(MetricsOutput, report)
+		}
+		return report.PrintTable(os.Stdout)
+	},
+}
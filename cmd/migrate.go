@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"soil/deploy"
+	"soil/util"
+)
+
+func init() {
+	rootCmd.AddCommand(migrateCmd)
+	migrateCmd.Flags().BoolVar(&util.DryRun, "dry-run", false, "Print what would be migrated without saving")
+}
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate [NAME...]",
+	Short: "Upgrade status files of deployments to the current schema version",
+	Long: "Upgrade status files of given deployments, or all deployments if no name given,\n" +
+		"to the current schema version. The original status is kept next to it as status.vN",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		names := args
+		if len(names) == 0 {
+			var err error
+			names, err = deploy.DeploymentNames()
+			if err != nil {
+				return err
+			}
+		}
+		ctx, cancel := commandContext()
+		defer cancel()
+		var failed error
+		for _, name := range names {
+			version, err := migrateDeployment(ctx, name, cmd.Name())
+			switch {
+			case errors.Is(err, deploy.ErrNotFound) && len(args) == 0:
+				fmt.Printf("%s: no status file, skipping\n", name)
+			case err != nil:
+				fmt.Printf("%s: %v\n", name, err)
+				failed = err
+			case version == deploy.STATUS_VERSION:
+				fmt.Printf("%s: up to date (version %d)\n", name, version)
+			default:
+				fmt.Printf("%s: migrated from version %d to %d\n", name, version, deploy.STATUS_VERSION)
+			}
+		}
+		if failed != nil && len(names) == 1 {
+			return failed
+		}
+		if failed != nil {
+			return fmt.Errorf("Some deployments were not migrated")
+		}
+		return nil
+	},
+}
+
+// migrateDeployment migrates the status holding the deployment lock, so that
+// the status saved by a running command is not overwritten.
+func migrateDeployment(ctx context.Context, name string, command string) (int, error) {
+	unlock, err := deploy.LockDeployment(ctx, name, command)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+	return deploy.MigrateDeployment(name)
+}
@@ -2,7 +2,6 @@ package cmd
 
 import (
 	"fmt"
-	"log"
 
 	"github.com/spf13/cobra"
 	"soil/deploy"
@@ -10,6 +9,7 @@ import (
 
 func init() {
 	rootCmd.AddCommand(removeCmd)
+	removeCmd.Flags().BoolVarP(&Force, "force", "f", false, "Remove the workdir even if terraform destroy fails")
 }
 
 var removeCmd = &cobra.Command{
@@ -17,16 +17,23 @@ var removeCmd = &cobra.Command{
 	Aliases: []string{"rm"},
 	Short:   "Remove deployment with given name",
 	Args:    cobra.MaximumNArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		name := "default"
 		if len(args) > 0 {
 			name = args[0]
 		}
+		ctx, cancel := commandContext()
+		defer cancel()
+		unlock, err := deploy.LockDeployment(ctx, name, cmd.Name())
+		if err != nil {
+			return commandError(ctx, err)
+		}
+		defer unlock()
 		d, err := deploy.LookupDeployment(name)
 		if err != nil {
-			log.Fatalf("No deployment found with name '%s': %v", name, err)
+			return err
 		}
 		fmt.Printf("Removing %s...\n", d.DName())
-		d.Remove(Force)
+		return commandError(ctx, d.Remove(ctx, Force))
 	},
 }
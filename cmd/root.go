@@ -1,23 +1,38 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
 	"soil/deploy"
+	"soil/util"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
-	_ "github.com/spf13/viper"
 )
 
 // var DeploymentName string
 var DeploymentType string
 var Force bool
+var Soilfile string
+var Timeout time.Duration
 
 var rootCmd = &cobra.Command{
 	Use:   "so",
 	Short: "Soil is a tool for deploying systems in different environments.",
 	Long: "Deploy one or more clusters, run test, observe the results,\n" +
-		"for details, please, refer https://github.com/kshtsk/soil/",
+		"for details, please, refer https://github.com/kshtsk/soil/\n\n" +
+		"Defaults of deploy options can be set in $SOIL_HOME/soil.yaml,\n" +
+		"in soil.yaml of the project, or as SOIL_* environment variables.",
+	// arguments are validated before, so runtime errors do not need usage
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		return applyConfig(cmd)
+	},
+	SilenceErrors: true,
 	Run: func(cmd *cobra.Command, args []string) {
 		// Do Stuff Here
 		fmt.Printf("Hello, I'm Soil (%s).\n\n", Version())
@@ -27,17 +42,93 @@ var rootCmd = &cobra.Command{
 
 func init() {
 	// rootCmd.PersistentFlags().StringVarP(&DeploymentName, "name", "n", "default", "Deployment name")
-	rootCmd.PersistentFlags().BoolVarP(&Force, "force", "f", false, "Force")
-	deployCmd.Flags().StringVarP(&DeploymentType, "type", "t", "k3d", "Deployment Type")
+	// -f is the shorthand of --file on deploy and of --force on remove
+	rootCmd.PersistentFlags().BoolVar(&Force, "force", false, "Force")
+	rootCmd.PersistentFlags().StringVar(&deploy.Home, "home", "",
+		"Directory keeping deployments and soil.yaml, $SOIL_HOME or $HOME/.soil by default")
+	rootCmd.PersistentFlags().DurationVar(&Timeout, "timeout", 0, "Abort the command after given time, e.g. 2h")
+	deployCmd.Flags().StringVarP(&DeploymentType, "type", "t", "k3d",
+		"Deployment type, one of: "+strings.Join(deploy.KindNames(), ", "))
 	deployCmd.Flags().StringVarP(&deploy.TerraformRepoRef, "terraform-repo-ref", "r",
 		"https://github.com/moio/scalability-tests", "Terraform git repo ref")
 	deployCmd.Flags().StringVarP(&deploy.TerraformWorkDir, "terraform-work-dir", "w", "", "Terraform work dir")
 	deployCmd.Flags().StringVarP(&deploy.TerraformVarFile, "terraform-var-file", "v", "", "Terraform var file")
+	deployCmd.Flags().StringVar(&deploy.InventoryFile, "inventory", "",
+		"Inventory of hosts of the ssh deployment type, replaces the terraform var file")
+	deployCmd.Flags().IntVar(&deploy.RancherReplicas, "replicas", 0, "Number of rancher replicas, the default of the deployment type if not set")
+	deployCmd.Flags().BoolVar(&deploy.Resume, "resume", false, "Resume deployment skipping completed phases")
+	deployCmd.Flags().StringVar(&deploy.FromPhase, "from-phase", "",
+		"Run deployment starting from the phase, one of: "+strings.Join(deploy.PhaseNames(), ", "))
+	deployCmd.Flags().StringVar(&deploy.OnlyPhase, "only-phase", "", "Run only the given deployment phase")
+	deployCmd.MarkFlagsMutuallyExclusive("resume", "from-phase", "only-phase")
+	deployCmd.Flags().StringVarP(&Soilfile, "file", "f", "", "Soilfile declaring the deployment")
+	deployCmd.Flags().StringVar(&deploy.RancherVersion, "rancher-version", deploy.RancherVersion, "Rancher version")
+	deployCmd.Flags().StringVar(&deploy.CertManagerVersion, "cert-manager-version", deploy.CertManagerVersion,
+		"cert-manager chart version")
+	deployCmd.Flags().StringVar(&deploy.GrafanaVersion, "grafana-version", deploy.GrafanaVersion, "Grafana chart version")
+	deployCmd.Flags().StringVar(&deploy.MonitoringVersion, "monitoring-version", "",
+		"rancher-monitoring chart version, by default the one compatible with the rancher version")
+	deployCmd.Flags().StringToStringVar(&deploy.ChartURLs, "chart", nil,
+		"Chart URL of a release, e.g. rancher=https://example.com/rancher-2.8.0.tgz")
+	for _, f := range []string{"resume", "from-phase", "only-phase"} {
+		deployCmd.MarkFlagsMutuallyExclusive("file", f)
+	}
+	deployCmd.Flags().DurationVar(&deploy.PhaseTimeout, "phase-timeout", 0, "Abort a deployment phase after given time")
+	upgradeCmd.Flags().StringVar(&Upgrade.RancherVersion, "rancher-version", "", "Rancher version to upgrade to")
+	upgradeCmd.MarkFlagRequired("rancher-version")
+	upgradeCmd.Flags().StringVar(&Upgrade.RancherChartURL, "rancher-chart-url", "",
+		"Rancher chart URL, the one given at deploy time by default")
+	upgradeCmd.Flags().BoolVar(&Upgrade.RunTests, "test", false, "Run tests before and after the upgrade")
+	for _, c := range []*cobra.Command{deployCmd, upgradeCmd} {
+		c.Flags().DurationVar(&deploy.WaitTimeout, "wait-timeout", time.Hour,
+			"Time to wait for rancher and clusters to become ready")
+	}
+	for _, c := range []*cobra.Command{testCmd, upgradeCmd} {
+		c.Flags().StringVar(&deploy.SuiteName, "suite", "",
+			"Test suite, a name in $SOIL_HOME/suites, built-in, or a path, the one of the deployment by default")
+		c.Flags().StringToStringVar(&deploy.SuiteVars, "set", nil, "Override a var of the test suite, e.g. CONFIG_MAP_COUNT=5000")
+		c.Flags().StringVar(&deploy.K6Runner, "k6-runner", deploy.K6Runner,
+			"Where to run k6, one of: "+strings.Join(util.K6Runners, ", "))
+		c.Flags().BoolVar(&deploy.K6NoRecord, "no-record", false, "Do not send k6 metrics to mimir")
+	}
+	testCmd.Flags().StringToStringVar(&deploy.Reports, "report", nil,
+		"Write a report of the test run, FORMAT=PATH, formats: junit, md, e.g. junit=out.xml")
+	testCmd.Flags().StringVar(&deploy.Baseline, "baseline", "",
+		"Fail if results regressed against the test run, an id, latest or NAME/ID")
+	upgradeCmd.Flags().StringToStringVar(&deploy.Reports, "report", nil,
+		"Write reports of tests run with --test, FORMAT=PATH, suffixed with -before and -after, e.g. junit=out.xml")
+	upgradeCmd.Flags().StringVar(&deploy.Baseline, "baseline", "",
+		"Fail if results of tests after the upgrade regressed against the test run, an id, latest or NAME/ID")
+	testCompareCmd.Flags().StringVarP(&RunsDeployment, "deployment", "d", "default", "Deployment of the runs")
+	for _, c := range []*cobra.Command{testCmd, testCompareCmd} {
+		c.Flags().Float64Var(&deploy.RegressionTolerances.P95, "p95-tolerance", deploy.RegressionTolerances.P95,
+			"Allowed increase of p95 latency against the baseline, in percent")
+		c.Flags().Float64Var(&deploy.RegressionTolerances.ErrorRate, "error-rate-tolerance",
+			deploy.RegressionTolerances.ErrorRate, "Allowed increase of error rate against the baseline, in percentage points")
+	}
+	for _, c := range []*cobra.Command{deployCmd, removeCmd, testCmd, upgradeCmd} {
+		c.Flags().BoolVar(&util.DryRun, "dry-run", false, "Print commands instead of executing them")
+		c.Flags().BoolVar(&deploy.WaitLock, "wait-lock", false, "Wait for a busy deployment instead of failing")
+	}
+}
+
+// commandContext returns a context cancelled on SIGINT or SIGTERM,
+// or when Timeout is exceeded.
+func commandContext() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	if Timeout <= 0 {
+		return ctx, stop
+	}
+	ctx, cancel := context.WithTimeout(ctx, Timeout)
+	return ctx, func() {
+		cancel()
+		stop()
+	}
 }
 
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitCode(err))
 	}
 }
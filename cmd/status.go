@@ -2,13 +2,18 @@ package cmd
 
 import (
 	"fmt"
+	"os"
+
 	"github.com/spf13/cobra"
-	"log"
 	"soil/deploy"
 )
 
+var StatusOutput string
+
 func init() {
 	rootCmd.AddCommand(statusCmd)
+	statusCmd.Flags().StringVarP(&StatusOutput, "output", "o", "",
+		"Output format, one of: json, yaml, wide")
 }
 
 var statusCmd = &cobra.Command{
@@ -16,32 +21,72 @@ var statusCmd = &cobra.Command{
 	Aliases: []string{"st", "stat", "state"},
 	Short:   "Print deployment status",
 	Args:    cobra.MaximumNArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		switch StatusOutput {
+		case "", "json", "yaml", "wide":
+			return nil
+		}
+		return fmt.Errorf("Unknown output format '%s', expected one of: json, yaml, wide", StatusOutput)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := commandContext()
+		defer cancel()
 		if len(args) > 0 {
 			d, err := deploy.LookupDeployment(args[0])
 			if err != nil {
-				log.Fatalf("Deployment '%s' does not exists", args[0])
+				return err
+			}
+			if StatusOutput == "" {
+				description := d.Describe(ctx)
+				if ctx.Err() != nil {
+					return commandError(ctx, ctx.Err())
+				}
+				fmt.Printf("Deployment %s\n", description)
+				return nil
+			}
+			info := d.Info(ctx)
+			if ctx.Err() != nil {
+				return commandError(ctx, ctx.Err())
+			}
+			if StatusOutput == "wide" {
+				return deploy.PrintInfoTable(os.Stdout, []deploy.Info{info})
 			}
-			fmt.Printf("Deployment %s\n", d)
+			return printStatus(info)
 		} else {
-			dd := deploy.LookupDeployments()
+			dd, err := deploy.LookupDeployments()
+			if err != nil {
+				return err
+			}
+			if StatusOutput != "" {
+				infos := []deploy.Info{}
+				for _, d := range dd {
+					infos = append(infos, d.Info(ctx))
+				}
+				if ctx.Err() != nil {
+					return commandError(ctx, ctx.Err())
+				}
+				if StatusOutput == "wide" {
+					return deploy.PrintInfoTable(os.Stdout, infos)
+				}
+				return printStatus(infos)
+			}
 			if len(dd) < 1 {
 				fmt.Printf("No deployments present.\n")
-				return
+				return nil
 			}
 			for _, d := range dd {
-				/*
-					t := ""
-					switch d.(type) {
-					case *deploy.ScalabilityDeployment:
-						t = d.(*deploy.ScalabilityDeployment).Kind
-					default:
-						log.Printf("WARNING: Unhandled type: s", reflect.TypeOf(d).Elem())
-						t = "unknown"
-					}
-				*/
 				fmt.Printf("- %s\n", d.Brief())
 			}
 		}
+		return nil
 	},
 }
+
+func printStatus(v any) error {
+	return printStructured(StatusOutput, v)
+}
+
+// printStructured prints v as yaml or json.
+func printStructured(format string, v any) error {
+	return deploy.PrintStructured(os.Stdout, format, v)
+}
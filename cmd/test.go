@@ -1,13 +1,19 @@
 package cmd
 
 import (
+	"os"
+
 	"github.com/spf13/cobra"
-	"log"
 	"soil/deploy"
 )
 
+// RunsDeployment is the deployment of runs given to `so test compare` by id.
+var RunsDeployment string
+
 func init() {
 	rootCmd.AddCommand(testCmd)
+	testCmd.AddCommand(testRunsCmd)
+	testCmd.AddCommand(testCompareCmd)
 }
 
 var testCmd = &cobra.Command{
@@ -15,15 +21,66 @@ var testCmd = &cobra.Command{
 	Aliases: []string{"ts"},
 	Short:   "Run test on the given name",
 	Args:    cobra.MaximumNArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		name := "default"
 		if len(args) > 0 {
 			name = args[0]
 		}
+		ctx, cancel := commandContext()
+		defer cancel()
+		unlock, err := deploy.LockDeployment(ctx, name, cmd.Name())
+		if err != nil {
+			return commandError(ctx, err)
+		}
+		defer unlock()
 		d, err := deploy.LookupDeployment(name)
 		if err != nil {
-			log.Fatalf("No deployment found with name '%s': %v", name, err)
+			return err
+		}
+		return commandError(ctx, d.Test(ctx))
+	},
+}
+
+var testRunsCmd = &cobra.Command{
+	Use:   "runs [NAME]",
+	Short: "List test runs of the deployment",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := "default"
+		if len(args) > 0 {
+			name = args[0]
+		}
+		runs, err := deploy.ListRuns(name)
+		if err != nil {
+			return err
+		}
+		return deploy.PrintRuns(os.Stdout, runs)
+	},
+}
+
+var testCompareCmd = &cobra.Command{
+	Use:   "compare RUN_A RUN_B",
+	Short: "Compare p95 latency and error rate of test run RUN_B with RUN_A",
+	Long: "Compare p95 latency and error rate of test run RUN_B with RUN_A.\n\n" +
+		"Runs are ids listed by `so test runs`, latest, or NAME/ID of a run of another deployment.\n" +
+		"Fails if RUN_B regressed beyond the tolerances.",
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		a, err := deploy.LoadRun(RunsDeployment, args[0])
+		if err != nil {
+			return err
+		}
+		b, err := deploy.LoadRun(RunsDeployment, args[1])
+		if err != nil {
+			return err
+		}
+		comparisons := deploy.CompareRuns(a, b, deploy.RegressionTolerances)
+		if err := deploy.PrintComparisons(os.Stdout, comparisons); err != nil {
+			return err
+		}
+		if regressions := deploy.Regressions(comparisons); len(regressions) > 0 {
+			return &deploy.RegressionError{Baseline: a.ID, Run: b.ID, Regressions: regressions}
 		}
-		d.Test()
+		return nil
 	},
 }
@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"soil/deploy"
+)
+
+var Upgrade deploy.UpgradeOptions
+
+func init() {
+	rootCmd.AddCommand(upgradeCmd)
+}
+
+var upgradeCmd = &cobra.Command{
+	Use:   "upgrade [NAME]",
+	Short: "Upgrade rancher of the deployment in place",
+	Args:  cobra.MaximumNArgs(1),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if !Upgrade.RunTests && (len(deploy.Reports) > 0 || deploy.Baseline != "") {
+			return fmt.Errorf("--report and --baseline apply to tests, which run with --test only")
+		}
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := "default"
+		if len(args) > 0 {
+			name = args[0]
+		}
+		ctx, cancel := commandContext()
+		defer cancel()
+		unlock, err := deploy.LockDeployment(ctx, name, cmd.Name())
+		if err != nil {
+			return commandError(ctx, err)
+		}
+		defer unlock()
+		d, err := deploy.LookupDeployment(name)
+		if err != nil {
+			return err
+		}
+		return commandError(ctx, d.Upgrade(ctx, Upgrade))
+	},
+}
@@ -0,0 +1,139 @@
+package deploy
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const RANCHER_CHART = "https://releases.rancher.com/server-charts/latest/rancher-%s.tgz"
+const CERT_MANAGER_CHART = "https://charts.jetstack.io/charts/cert-manager-v%s.tgz"
+const GRAFANA_CHART = "https://github.com/grafana/helm-charts/releases/download/grafana-%[1]s/grafana-%[1]s.tgz"
+
+// RANCHER_MONITORING_CHART and RANCHER_MONITORING_CRD_CHART are formatted
+// with the rancher line, e.g. 2.7, and the chart version.
+const RANCHER_MONITORING_CHART = "https://github.com/rancher/charts/raw/release-v%s/assets/rancher-monitoring/rancher-monitoring-%s.tgz"
+const RANCHER_MONITORING_CRD_CHART = "https://github.com/rancher/charts/raw/release-v%s/assets/rancher-monitoring-crd/rancher-monitoring-crd-%s.tgz"
+
+// Versions of charts installed by new deployments, MonitoringVersion is
+// derived from RancherVersion by MonitoringVersions if not set.
+var (
+	RancherVersion     = "2.7.6"
+	CertManagerVersion = "1.8.0"
+	GrafanaVersion     = "6.56.5"
+	MonitoringVersion  = ""
+)
+
+// ChartURLs override chart URLs of new deployments by release name.
+var ChartURLs = map[string]string{}
+
+// MonitoringVersions is the rancher-monitoring chart version for a rancher line.
+var MonitoringVersions = map[string]string{
+	"2.6": "100.2.0+up40.1.2",
+	"2.7": "102.0.0+up40.1.2",
+	"2.8": "103.0.0+up45.31.1",
+}
+
+// versionedCharts are releases installed from charts of configurable version.
+var versionedCharts = []string{"rancher", "cert-manager", "grafana", "rancher-monitoring"}
+
+// remoteCharts are releases installed from chart URLs, which can be overridden.
+var remoteCharts = []string{"rancher", "cert-manager", "grafana", "rancher-monitoring", "rancher-monitoring-crd"}
+
+var versionPattern = regexp.MustCompile(`^v?\d+\.\d+\.\d+([-+][\w.+-]+)?$`)
+
+// rancherLine returns major and minor of the rancher version, e.g. 2.7.
+func rancherLine(version string) string {
+	parts := strings.SplitN(strings.TrimPrefix(version, "v"), ".", 3)
+	if len(parts) < 2 {
+		return version
+	}
+	return parts[0] + "." + parts[1]
+}
+
+func monitoringVersion(rancherVersion string) (string, error) {
+	line := rancherLine(rancherVersion)
+	v, ok := MonitoringVersions[line]
+	if !ok {
+		return "", fmt.Errorf("no rancher-monitoring version known for rancher %s, please, set it explicitly", line)
+	}
+	return v, nil
+}
+
+// chartURL returns URL of the chart of the release for the versions.
+func chartURL(name string, charts map[string]Chart) string {
+	if url := charts[name].URL; url != "" {
+		return url
+	}
+	version := charts[name].Version
+	switch name {
+	case "rancher":
+		return fmt.Sprintf(RANCHER_CHART, version)
+	case "cert-manager":
+		return fmt.Sprintf(CERT_MANAGER_CHART, version)
+	case "grafana":
+		return fmt.Sprintf(GRAFANA_CHART, version)
+	case "rancher-monitoring":
+		return fmt.Sprintf(RANCHER_MONITORING_CHART, rancherLine(charts["rancher"].Version),
+			strings.ReplaceAll(version, "+", "%2B"))
+	case "rancher-monitoring-crd":
+		return fmt.Sprintf(RANCHER_MONITORING_CRD_CHART, rancherLine(charts["rancher"].Version),
+			strings.ReplaceAll(charts["rancher-monitoring"].Version, "+", "%2B"))
+	}
+	return ""
+}
+
+/**
+ * resolveCharts: charts of a new deployment.
+ *
+ * Versions and URLs given in overrides take precedence over RancherVersion,
+ * CertManagerVersion, GrafanaVersion, MonitoringVersion and ChartURLs.
+ * rancher-monitoring version is derived from rancher version, unless set.
+ */
+func resolveCharts(overrides map[string]Chart) (map[string]Chart, error) {
+	for name := range ChartURLs {
+		if !contains(remoteCharts, name) {
+			return nil, fmt.Errorf("URL of chart '%s' can not be changed, expected one of: %s",
+				name, strings.Join(remoteCharts, ", "))
+		}
+	}
+	charts := map[string]Chart{}
+	for name, c := range overrides {
+		charts[name] = c
+	}
+	defaults := map[string]string{
+		"rancher":            RancherVersion,
+		"cert-manager":       CertManagerVersion,
+		"grafana":            GrafanaVersion,
+		"rancher-monitoring": MonitoringVersion,
+	}
+	for _, name := range remoteCharts {
+		c := charts[name]
+		if c.Version == "" {
+			c.Version = defaults[name]
+		}
+		c.Version = strings.TrimPrefix(c.Version, "v")
+		if c.URL == "" {
+			c.URL = ChartURLs[name]
+		}
+		charts[name] = c
+	}
+	monitoring := charts["rancher-monitoring"]
+	if monitoring.Version == "" {
+		v, err := monitoringVersion(charts["rancher"].Version)
+		if err != nil {
+			return nil, err
+		}
+		monitoring.Version = v
+		charts["rancher-monitoring"] = monitoring
+	}
+	crd := charts["rancher-monitoring-crd"]
+	crd.Version = monitoring.Version
+	charts["rancher-monitoring-crd"] = crd
+	for _, name := range versionedCharts {
+		if !versionPattern.MatchString(charts[name].Version) {
+			return nil, fmt.Errorf("invalid version '%s' of chart '%s'", charts[name].Version, name)
+		}
+	}
+	return charts, nil
+}
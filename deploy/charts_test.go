@@ -0,0 +1,39 @@
+package deploy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveCharts(t *testing.T) {
+	charts, err := resolveCharts(map[string]Chart{"rancher": {Version: "v2.8.2"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "2.8.2", charts["rancher"].Version)
+	assert.Equal(t, MonitoringVersions["2.8"], charts["rancher-monitoring"].Version)
+	assert.Equal(t, MonitoringVersions["2.8"], charts["rancher-monitoring-crd"].Version)
+	assert.Equal(t, CertManagerVersion, charts["cert-manager"].Version)
+	assert.Equal(t, "https://releases.rancher.com/server-charts/latest/rancher-2.8.2.tgz", chartURL("rancher", charts))
+	assert.Equal(t, "https://github.com/rancher/charts/raw/release-v2.8/assets/rancher-monitoring/rancher-monitoring-103.0.0%2Bup45.31.1.tgz",
+		chartURL("rancher-monitoring", charts))
+}
+
+func TestResolveChartsUnknownRancherLine(t *testing.T) {
+	_, err := resolveCharts(map[string]Chart{"rancher": {Version: "3.0.0"}})
+	assert.Error(t, err)
+
+	charts, err := resolveCharts(map[string]Chart{
+		"rancher":            {Version: "3.0.0"},
+		"rancher-monitoring": {Version: "105.0.0+up60.0.0"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "105.0.0+up60.0.0", charts["rancher-monitoring-crd"].Version)
+}
+
+func TestResolveChartsURL(t *testing.T) {
+	ChartURLs = map[string]string{"grafana": "https://example.com/grafana.tgz"}
+	defer func() { ChartURLs = map[string]string{} }()
+	charts, err := resolveCharts(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com/grafana.tgz", chartURL("grafana", charts))
+}
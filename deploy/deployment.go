@@ -1,27 +1,43 @@
 package deploy
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
 	"reflect"
+	"soil/util"
+	"time"
 )
 
 const DEPLOYMENTS_DIR string = "$HOME/.soil"
 
+// Home is the directory keeping deployments, overrides SOIL_HOME
+// environment variable and DEPLOYMENTS_DIR.
+var Home string
+
+// RancherReplicas is the number of rancher replicas of new deployments,
+// if not set, the default of the kind.
+var RancherReplicas int
+
 type Deployment interface {
-	Make() string
-	Test()
-	Remove(bool)
-	makeWorkdir(any) string
-	saveStatus()
+	Make(context.Context) (string, error)
+	Test(context.Context) error
+	Remove(context.Context, bool) error
+	Upgrade(context.Context, UpgradeOptions) error
+	Metrics(context.Context, MetricsOptions) (*MetricsReport, error)
+	makeWorkdir(any) (string, error)
+	saveStatus() error
 	DName() string
 	Brief() string
+	Describe(context.Context) string
 	StatusFile() string
-	CheckRequirements() bool
+	CheckRequirements(context.Context) bool
 	Extra() map[string]interface{}
+	Info(context.Context) Info
 }
 
 type CommonDeployment struct {
@@ -33,6 +49,14 @@ func (d CommonDeployment) Brief() string {
 	return fmt.Sprintf("%s", d.Name)
 }
 
+func (d CommonDeployment) Describe(ctx context.Context) string {
+	return fmt.Sprintf("'%s'\n", d.Name)
+}
+
+func (d CommonDeployment) Info(ctx context.Context) Info {
+	return Info{Name: d.Name, Workdir: d.Workdir()}
+}
+
 func (d CommonDeployment) DName() string {
 	return d.Name
 }
@@ -41,14 +65,24 @@ func (d CommonDeployment) Workdir() string {
 	return workdir(d.Name)
 }
 
+// SoilHome returns the directory keeping deployments and user config.
+func SoilHome() string {
+	return deploymentsDir()
+}
+
 func deploymentsDir() (path string) {
-	path, _ = filepath.Abs(os.ExpandEnv(DEPLOYMENTS_DIR))
+	dir := Home
+	if dir == "" {
+		dir = os.Getenv("SOIL_HOME")
+	}
+	if dir == "" {
+		dir = DEPLOYMENTS_DIR
+	}
+	path, _ = filepath.Abs(os.ExpandEnv(dir))
 	return
 }
 func workdir(name string) (path string) {
-	path, _ = filepath.Abs(os.ExpandEnv(
-		fmt.Sprintf("%s/%s", DEPLOYMENTS_DIR, name)))
-	return
+	return filepath.Join(deploymentsDir(), name)
 }
 
 func DeploymentWorkdir(p Deployment) string {
@@ -56,14 +90,34 @@ func DeploymentWorkdir(p Deployment) string {
 }
 
 type Status struct {
+	Version        int                    `json:"version"`
 	Deployment     Deployment             `json:"deployment"`
 	DeploymentType string                 `json:"type"`
 	Name           string                 `json:"name"`
-	Extra          map[string]interface{} `json:"extra""`
+	Extra          map[string]interface{} `json:"extra"`
 	// Extra parameters type dependent
 	//
 }
 
+// statusTypes maps deployment type names stored in status file to go types.
+var statusTypes = map[string]reflect.Type{
+	"scalability": reflect.TypeOf(ScalabilityDeployment{}),
+	"common":      reflect.TypeOf(CommonDeployment{}),
+}
+
+func statusTypeName(d Deployment) string {
+	t := reflect.TypeOf(d)
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	for name, ty := range statusTypes {
+		if ty == t {
+			return name
+		}
+	}
+	return t.String()
+}
+
 func statusFile(name string) string {
 	return fmt.Sprintf("%s/status", workdir(name))
 }
@@ -71,71 +125,118 @@ func (d CommonDeployment) StatusFile() string {
 	return fmt.Sprintf("%s/status", d.Workdir())
 }
 
-func (d CommonDeployment) makeWorkdir(p any) (path string) {
+func (d CommonDeployment) makeWorkdir(p any) (path string, err error) {
 	path = d.Workdir()
+	if util.DryRun {
+		log.Printf("Dry run, skipping creation of '%s'", path)
+		return
+	}
 	log.Printf("Checking '%s' exists...", path)
-	if _, err := os.Stat(path); os.IsNotExist(err) {
+	if _, err = os.Stat(path); os.IsNotExist(err) {
 		// create path
-		os.MkdirAll(path, 0755)
+		err = os.MkdirAll(path, 0755)
 	} else {
 		log.Printf("Working directory already exists")
 	}
 	return
 }
 
-func storeStatus(s Status) {
-	data, _ := json.Marshal(s)
+func storeStatus(s Status) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
 	log.Printf("Status: %s\n", string(data))
 	path := s.Deployment.StatusFile()
+	if util.DryRun {
+		log.Printf("Dry run, skipping saving status to: %s", path)
+		return nil
+	}
+	if err := backupStatus(path); err != nil {
+		return err
+	}
 	log.Printf("Saving status to: %s", path)
-	f, _ := os.Create(path)
-	f.Write(data)
-	defer f.Close()
+	if err := util.WriteFileAtomic(path, data, 0644); err != nil {
+		return fmt.Errorf("Failed to save status of deployment '%s': %w", s.Name, err)
+	}
+	return nil
 }
 
-func (d CommonDeployment) Test() {
-	log.Panicf("Test is not implemented for deployment: %s", reflect.TypeOf(d).Elem())
+func (d CommonDeployment) Test(ctx context.Context) error {
+	return fmt.Errorf("Test is not implemented for deployment: %s", reflect.TypeOf(d))
 }
-func saveStatus(d Deployment) {
+func saveStatus(d Deployment) error {
 	log.Printf("Saving deployment status for %s of type %s\n",
-		d.DName(), reflect.TypeOf(d).Elem())
+		d.DName(), statusTypeName(d))
 	s := Status{
+		Version:        STATUS_VERSION,
 		Deployment:     d,
 		Name:           d.DName(),
-		DeploymentType: fmt.Sprintf("%s", reflect.TypeOf(d).Elem()),
+		DeploymentType: statusTypeName(d),
 		Extra:          d.Extra(),
 	}
-	storeStatus(s)
+	return storeStatus(s)
 }
 
-func MakeDeployment(name string, kind Kind) Deployment {
+// RESERVED_NAMES are subcommands of `so test`, a deployment named after
+// one of them could not be tested.
+var RESERVED_NAMES = []string{"runs", "compare"}
+
+func MakeDeployment(name string, kind Kind) (Deployment, error) {
+	for _, reserved := range RESERVED_NAMES {
+		if name == reserved {
+			return nil, fmt.Errorf("Deployment name '%s' is reserved, choose another name", name)
+		}
+	}
+	charts, err := resolveCharts(nil)
+	if err != nil {
+		return nil, err
+	}
+	d := makeDeployment(name, kind, charts)
+	if InventoryFile != "" {
+		if err := d.applyInventory(InventoryFile); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+func makeDeployment(name string, kind Kind, charts map[string]Chart) ScalabilityDeployment {
 	log.Printf("Creating deployment: %s", name)
-	replicas := 3
-	if kind.Name == "k3d" {
-		replicas = 1
+	replicas := RancherReplicas
+	if replicas <= 0 {
+		replicas = kind.Replicas
+	}
+	if replicas <= 0 {
+		replicas = DEFAULT_REPLICAS
 	}
 	return ScalabilityDeployment{
 		CommonDeployment: CommonDeployment{Name: name},
+		Charts:           charts,
+		CreatedAt:        time.Now().UTC(),
 		Repo:             kind.TerraformRepoRef,
 		TerraformWorkDir: kind.TerraformWorkDir,
 		TerraformVarFile: kind.TerraformVarFile,
 		RancherReplicas:  replicas,
 		Kind:             kind.Name,
+		KindPlugin:       kind.Plugin,
 	}
 }
 
 func (c *Status) UnmarshalJSON(data []byte) error {
-	m, err := UnmarshalStatus(data, map[string]reflect.Type{
-		"deploy.ScalabilityDeployment": reflect.TypeOf(ScalabilityDeployment{}),
-		"deploy.CommonDeployment":      reflect.TypeOf(CommonDeployment{}),
-	})
+	m, err := UnmarshalStatus(data, statusTypes)
+	if err != nil {
+		return err
+	}
+	version, err := statusVersion(m)
 	if err != nil {
 		return err
 	}
+	c.Version = version
 	c.Deployment = m["deployment"].(Deployment)
 	c.DeploymentType = m["type"].(string)
-	c.Name = m["name"].(string)
-	c.Extra = m["extra"].(map[string]interface{})
+	c.Name, _ = m["name"].(string)
+	c.Extra, _ = m["extra"].(map[string]interface{})
 
 	return nil
 }
@@ -146,11 +247,13 @@ func UnmarshalStatus(data []byte, customTypes map[string]reflect.Type) (map[stri
 		return nil, err
 	}
 
-	typeName := m["type"].(string)
+	typeName, _ := m["type"].(string)
 
 	var value Deployment
 	if ty, found := customTypes[typeName]; found {
 		value = reflect.New(ty).Interface().(Deployment)
+	} else {
+		return nil, fmt.Errorf("unknown deployment type '%s'", typeName)
 	}
 
 	valueBytes, err := json.Marshal(m["deployment"])
@@ -168,38 +271,37 @@ func UnmarshalStatus(data []byte, customTypes map[string]reflect.Type) (map[stri
 
 var _ json.Unmarshaler = (*Status)(nil)
 
-func LookupDeployments() []Deployment {
-	items, err := os.ReadDir(deploymentsDir())
+func LookupDeployments() ([]Deployment, error) {
+	deployments := []Deployment{}
+	names, err := DeploymentNames()
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
-	deployments := []Deployment{}
-	for _, f := range items {
-		if f.IsDir() {
-			d, err := LookupDeployment(f.Name())
-			if err == nil {
-				deployments = append(deployments, d)
-			} else {
-				log.Printf("Deployment '%s' is not created yet", d.DName())
-			}
+	for _, name := range names {
+		d, err := LookupDeployment(name)
+		if err == nil {
+			deployments = append(deployments, d)
+		} else if errors.Is(err, ErrNotFound) {
+			log.Printf("Deployment '%s' is not created yet", name)
+		} else {
+			log.Printf("Skipping deployment '%s': %v", name, err)
 		}
 	}
-	return deployments
+	return deployments, nil
 }
 
 func LookupDeployment(name string) (Deployment, error) {
 	workdir := workdir(name)
 	log.Printf("Looking up for deployment '%s' in directory '%s'", name, workdir)
-	data, err := os.ReadFile(statusFile(name))
+	// status of an older version is saved by commands holding the lock
+	data, _, err := readStatusFile(name)
 	if err != nil {
-		log.Output(2, fmt.Sprintln(err))
 		return nil, err
 	}
 	var s Status
 	err = json.Unmarshal(data, &s)
 	if err != nil {
-		fmt.Println(err)
-		return nil, err
+		return nil, fmt.Errorf("Invalid status of deployment '%s': %w", name, err)
 	}
 	p := s.Deployment
 	return p, nil
@@ -3,12 +3,16 @@ package deploy
 import (
 	"encoding/json"
 	"fmt"
+	"path/filepath"
 	"reflect"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func TestDeploymentMake(t *testing.T) {
-	d := MakeDeployment("test_deployment", KindMap["k3d"])
+	d, err := MakeDeployment("test_deployment", testKind(t, "k3d"))
+	assert.NoError(t, err)
 	fmt.Printf("Deployment Name: %s\n", d.DName())
 	p := &d
 	fmt.Printf("Deployment Type: %s\n", reflect.TypeOf(d))
@@ -16,6 +20,13 @@ func TestDeploymentMake(t *testing.T) {
 	fmt.Printf("Pointer Type: %s\n", reflect.TypeOf(*p))
 }
 
+func TestMakeDeploymentReservedName(t *testing.T) {
+	for _, name := range RESERVED_NAMES {
+		_, err := MakeDeployment(name, testKind(t, "k3d"))
+		assert.ErrorContains(t, err, "'"+name+"' is reserved")
+	}
+}
+
 type X struct {
 	Name string `json:"name"`
 	Age  string `json:"age"`
@@ -37,3 +48,30 @@ func TestEncodingJson(t *testing.T) {
 	}
 	fmt.Printf("Unmarshalled: %s, type %s\n", dx, reflect.TypeOf(dx))
 }
+
+func TestSoilHome(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("SOIL_HOME", "")
+	assert.Equal(t, filepath.Join(home, ".soil"), SoilHome())
+
+	t.Setenv("SOIL_HOME", filepath.Join(home, "env"))
+	assert.Equal(t, filepath.Join(home, "env", "test"), workdir("test"))
+
+	Home = filepath.Join(home, "flag")
+	defer func() { Home = "" }()
+	assert.Equal(t, filepath.Join(home, "flag", "test", "status"), statusFile("test"))
+}
+
+func TestMakeDeploymentReplicas(t *testing.T) {
+	replicas := func(kind string) int {
+		d, err := MakeDeployment("test", testKind(t, kind))
+		assert.NoError(t, err)
+		return d.(ScalabilityDeployment).RancherReplicas
+	}
+	assert.Equal(t, 1, replicas("k3d"))
+	assert.Equal(t, 3, replicas("aws"))
+	RancherReplicas = 2
+	defer func() { RancherReplicas = 0 }()
+	assert.Equal(t, 2, replicas("k3d"))
+}
@@ -0,0 +1,35 @@
+package deploy
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNotFound is returned when there is no deployment with given name.
+var ErrNotFound = errors.New("deployment not found")
+
+// StepError reports a failed deployment step, e.g. a helm release install.
+type StepError struct {
+	Phase string
+	Step  string
+	Err   error
+}
+
+func (e *StepError) Error() string {
+	if e.Phase == "" {
+		return fmt.Sprintf("step '%s' failed: %v", e.Step, e.Err)
+	}
+	return fmt.Sprintf("phase '%s', step '%s' failed: %v", e.Phase, e.Step, e.Err)
+}
+
+func (e *StepError) Unwrap() error {
+	return e.Err
+}
+
+// stepError returns StepError for the step, or nil if err is nil.
+func stepError(step string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &StepError{Step: step, Err: err}
+}
@@ -0,0 +1,168 @@
+package deploy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Info is a machine readable description of a deployment.
+type Info struct {
+	Name             string         `json:"name" yaml:"name"`
+	Kind             string         `json:"kind,omitempty" yaml:"kind,omitempty"`
+	Repo             string         `json:"repo,omitempty" yaml:"repo,omitempty"`
+	Branch           string         `json:"branch,omitempty" yaml:"branch,omitempty"`
+	Workdir          string         `json:"workdir" yaml:"workdir"`
+	TerraformWorkDir string         `json:"terraform_work_dir,omitempty" yaml:"terraform_work_dir,omitempty"`
+	Replicas         int            `json:"replicas,omitempty" yaml:"replicas,omitempty"`
+	State            string         `json:"state,omitempty" yaml:"state,omitempty"`
+	Phase            string         `json:"phase,omitempty" yaml:"phase,omitempty"`
+	CompletedPhases  []string       `json:"completed_phases,omitempty" yaml:"completed_phases,omitempty"`
+	CreatedAt        *time.Time     `json:"created_at,omitempty" yaml:"created_at,omitempty"`
+	Charts           []ChartInfo    `json:"charts,omitempty" yaml:"charts,omitempty"`
+	History          []HistoryEntry `json:"history,omitempty" yaml:"history,omitempty"`
+	Clusters         []ClusterInfo  `json:"clusters,omitempty" yaml:"clusters,omitempty"`
+}
+
+// ClusterInfo describes access to a cluster of a deployment.
+type ClusterInfo struct {
+	Name               string            `json:"name" yaml:"name"`
+	Kubeconfig         string            `json:"kubeconfig" yaml:"kubeconfig"`
+	Context            string            `json:"context" yaml:"context"`
+	RancherUrl         string            `json:"rancher_url,omitempty" yaml:"rancher_url,omitempty"`
+	GrafanaUrl         string            `json:"grafana_url,omitempty" yaml:"grafana_url,omitempty"`
+	NodeAccessCommands map[string]string `json:"node_access_commands,omitempty" yaml:"node_access_commands,omitempty"`
+}
+
+// ChartInfo describes a chart installed by a deployment.
+type ChartInfo struct {
+	Name    string `json:"name" yaml:"name"`
+	Version string `json:"version" yaml:"version"`
+	URL     string `json:"url" yaml:"url"`
+}
+
+// RancherVersion returns version of the installed rancher, if known.
+func (i Info) RancherVersion() string {
+	for _, c := range i.Charts {
+		if c.Name == "rancher" {
+			return c.Version
+		}
+	}
+	return ""
+}
+
+// RancherUrl returns url of the rancher UI, if known.
+func (i Info) RancherUrl() string {
+	for _, c := range i.Clusters {
+		if c.RancherUrl != "" {
+			return c.RancherUrl
+		}
+	}
+	return ""
+}
+
+// GrafanaUrl returns url of the test results dashboard, if known.
+func (i Info) GrafanaUrl() string {
+	for _, c := range i.Clusters {
+		if c.GrafanaUrl != "" {
+			return c.GrafanaUrl
+		}
+	}
+	return ""
+}
+
+func clusterInfo(c Cluster) ClusterInfo {
+	return ClusterInfo{
+		Name:               c.Name,
+		Kubeconfig:         c.Kubeconfig,
+		Context:            c.Context,
+		NodeAccessCommands: c.NodeAccessCommands,
+	}
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "unknown"
+	}
+	return t.Local().Format(time.RFC3339)
+}
+
+/**
+ * Info: describe the deployment, clusters are described if their outputs can
+ * be read, which runs terraform or the kind plugin.
+ */
+func (d ScalabilityDeployment) Info(ctx context.Context) Info {
+	info := Info{
+		Name:             d.Name,
+		Kind:             d.Kind,
+		Repo:             d.Repo,
+		Branch:           d.Branch,
+		Workdir:          d.Workdir(),
+		TerraformWorkDir: d.TerraformWorkDir,
+		Replicas:         d.RancherReplicas,
+		State:            d.State,
+		Phase:            d.Phase,
+		CompletedPhases:  d.CompletedPhases,
+		History:          d.History,
+	}
+	if !d.CreatedAt.IsZero() {
+		info.CreatedAt = &d.CreatedAt
+	}
+	for _, name := range remoteCharts {
+		if c, ok := d.Charts[name]; ok {
+			info.Charts = append(info.Charts, ChartInfo{Name: name, Version: c.Version, URL: d.chartURL(name)})
+		}
+	}
+	outputs, err := d.getOutputs(ctx)
+	if err != nil {
+		log.Printf("No cluster details of '%s': %v", d.Name, err)
+		return info
+	}
+	upstream := clusterInfo(outputs.Upstream())
+	upstream.RancherUrl = outputs.Upstream().LocalUrl()
+	info.Clusters = append(info.Clusters, upstream)
+	for _, c := range outputs.Downstream() {
+		info.Clusters = append(info.Clusters, clusterInfo(c))
+	}
+	tester := clusterInfo(outputs.Tester())
+	tester.GrafanaUrl = outputs.Tester().GrafanaUrl()
+	info.Clusters = append(info.Clusters, tester)
+	return info
+}
+
+// PrintStructured writes v as yaml or json, the format of `-o yaml|json`.
+func PrintStructured(out io.Writer, format string, v any) error {
+	if format == "yaml" {
+		e := yaml.NewEncoder(out)
+		e.SetIndent(2)
+		defer e.Close()
+		return e.Encode(v)
+	}
+	e := json.NewEncoder(out)
+	e.SetIndent("", "  ")
+	return e.Encode(v)
+}
+
+// PrintInfoTable writes a table of the deployments, the format of `so status -o wide`.
+func PrintInfoTable(out io.Writer, infos []Info) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tKIND\tVERSION\tSTATE\tPHASE\tREPLICAS\tCREATED\tREPO\tBRANCH\tRANCHER\tGRAFANA")
+	for _, i := range infos {
+		created := "-"
+		if i.CreatedAt != nil {
+			created = i.CreatedAt.Local().Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			i.Name, dashIfEmpty(i.Kind), dashIfEmpty(i.RancherVersion()), dashIfEmpty(i.State), dashIfEmpty(i.Phase),
+			strconv.Itoa(i.Replicas), created, dashIfEmpty(i.Repo), dashIfEmpty(i.Branch),
+			dashIfEmpty(i.RancherUrl()), dashIfEmpty(i.GrafanaUrl()))
+	}
+	return w.Flush()
+}
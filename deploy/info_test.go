@@ -0,0 +1,111 @@
+package deploy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func newTestInfoDeployment(t *testing.T) ScalabilityDeployment {
+	d, _ := newTestDeployment(t)
+	d.State = StateDeployed
+	d.CompletedPhases = PhaseNames()
+	d.CreatedAt = time.Date(2023, 9, 1, 12, 0, 0, 0, time.UTC)
+	return d
+}
+
+func TestInfo(t *testing.T) {
+	d := newTestInfoDeployment(t)
+	info := d.Info(context.Background())
+	assert.Equal(t, "test", info.Name)
+	assert.Equal(t, "k3d", info.Kind)
+	assert.Equal(t, StateDeployed, info.State)
+	assert.Equal(t, d.Workdir(), info.Workdir)
+	assert.Equal(t, "2.7.6", info.RancherVersion())
+	assert.Equal(t, "https://upstream.local.gd:8444", info.RancherUrl())
+	assert.Equal(t, "http://tester.local.gd:8080"+GRAFANA_DASHBOARD_PATH, info.GrafanaUrl())
+	names := []string{}
+	for _, c := range info.Clusters {
+		names = append(names, c.Name)
+	}
+	assert.Equal(t, []string{"upstream", "downstream", "tester"}, names)
+	assert.Equal(t, ClusterInfo{Name: "downstream", Kubeconfig: "/tmp/downstream.yaml", Context: "k3d-downstream",
+		NodeAccessCommands: map[string]string{}}, info.Clusters[1])
+}
+
+func TestInfoNoOutputs(t *testing.T) {
+	d := newTestInfoDeployment(t)
+	f := newTestExecutor()
+	d.Executor = f
+	assert.NoError(t, os.Remove(d.getTerraformStatePath()))
+	info := d.Info(context.Background())
+	assert.Equal(t, "test", info.Name)
+	assert.Empty(t, info.Clusters)
+	assert.Equal(t, "", info.RancherUrl())
+	assert.Empty(t, f.Commands)
+
+	// outputs are not read once the command is interrupted
+	d, _ = newTestDeployment(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Empty(t, d.Info(ctx).Clusters)
+}
+
+func TestPrintStructured(t *testing.T) {
+	info := newTestInfoDeployment(t).Info(context.Background())
+
+	out := &bytes.Buffer{}
+	assert.NoError(t, PrintStructured(out, "json", []Info{info}))
+	parsed := []Info{}
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &parsed))
+	assert.Len(t, parsed, 1)
+	assert.Len(t, parsed[0].Clusters, 3)
+	assert.Equal(t, info.RancherUrl(), parsed[0].RancherUrl())
+	assert.Equal(t, info.GrafanaUrl(), parsed[0].GrafanaUrl())
+	assert.True(t, info.CreatedAt.Equal(*parsed[0].CreatedAt))
+	assert.Contains(t, out.String(), `"rancher_url": "https://upstream.local.gd:8444"`)
+
+	out.Reset()
+	assert.NoError(t, PrintStructured(out, "yaml", info))
+	assert.Contains(t, out.String(), "\nclusters:\n  - name: upstream\n")
+	assert.Contains(t, out.String(), "    rancher_url: https://upstream.local.gd:8444\n")
+	parsedInfo := Info{}
+	assert.NoError(t, yaml.Unmarshal(out.Bytes(), &parsedInfo))
+	assert.Equal(t, info.Charts, parsedInfo.Charts)
+	assert.Equal(t, info.CompletedPhases, parsedInfo.CompletedPhases)
+}
+
+func TestPrintInfoTable(t *testing.T) {
+	info := newTestInfoDeployment(t).Info(context.Background())
+	out := &bytes.Buffer{}
+	assert.NoError(t, PrintInfoTable(out, []Info{info, {Name: "empty"}}))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, lines, 3)
+	assert.Equal(t, []string{"NAME", "KIND", "VERSION", "STATE", "PHASE", "REPLICAS", "CREATED", "REPO", "BRANCH",
+		"RANCHER", "GRAFANA"}, strings.Fields(lines[0]))
+	assert.Equal(t, []string{"test", "k3d", "2.7.6", "deployed", "-", "1", info.CreatedAt.Local().Format(time.RFC3339),
+		"https://github.com/moio/scalability-tests", "-", "https://upstream.local.gd:8444", info.GrafanaUrl()},
+		strings.Fields(lines[1]))
+	assert.Equal(t, []string{"empty", "-", "-", "-", "-", "0", "-", "-", "-", "-", "-"}, strings.Fields(lines[2]))
+}
+
+func TestDescribe(t *testing.T) {
+	d := newTestInfoDeployment(t)
+	text := d.Describe(context.Background())
+	assert.True(t, strings.HasPrefix(text, d.String()))
+	assert.Contains(t, text, "    *** UPSTREAM CLUSTER\n")
+	assert.Contains(t, text, "      Rancher UI: https://upstream.local.gd:8444 (admin/"+ADMIN_PASSWORD+")\n")
+	assert.NotContains(t, d.String(), "ACCESS DETAILS")
+
+	// access details are not read once the command is interrupted
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, d.String(), d.Describe(ctx))
+}
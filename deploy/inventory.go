@@ -0,0 +1,201 @@
+package deploy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// InventoryFile is the inventory of hosts of new ssh deployments, if set.
+var InventoryFile string
+
+// Roles of inventory hosts
+const (
+	RoleUpstream   = "upstream"
+	RoleDownstream = "downstream"
+	RoleTester     = "tester"
+)
+
+var inventoryRoles = []string{RoleUpstream, RoleDownstream, RoleTester}
+
+// InventoryHost is a host the ssh kind installs a cluster node to.
+type InventoryHost struct {
+	Name    string `yaml:"name" json:"name"`
+	Address string `yaml:"address" json:"address"`
+	User    string `yaml:"user,omitempty" json:"user,omitempty"`
+	Key     string `yaml:"key,omitempty" json:"key,omitempty"`
+	Port    int    `yaml:"port,omitempty" json:"port,omitempty"`
+	Role    string `yaml:"role" json:"role"`
+	// Cluster groups downstream hosts to clusters, the role name by default
+	Cluster string `yaml:"cluster,omitempty" json:"cluster,omitempty"`
+}
+
+// Inventory lists hosts of an ssh deployment, Defaults apply to hosts not
+// setting user, key or port.
+type Inventory struct {
+	Defaults InventoryHost   `yaml:"defaults,omitempty" json:"defaults"`
+	Hosts    []InventoryHost `yaml:"hosts" json:"hosts"`
+}
+
+func expandHome(path string) string {
+	if home, err := os.UserHomeDir(); err == nil && strings.HasPrefix(path, "~/") {
+		return filepath.Join(home, path[2:])
+	}
+	return path
+}
+
+/**
+ * LoadInventory: load and validate the inventory file.
+ *
+ * Defaults are applied to the hosts, the port is 22 and the user root if not set.
+ */
+func LoadInventory(path string) (*Inventory, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read inventory: %w", err)
+	}
+	inv := &Inventory{}
+	if err := yaml.Unmarshal(data, inv); err != nil {
+		return nil, fmt.Errorf("Invalid inventory %s: %w", path, err)
+	}
+	for i := range inv.Hosts {
+		h := &inv.Hosts[i]
+		if h.User == "" {
+			h.User = inv.Defaults.User
+		}
+		if h.User == "" {
+			h.User = "root"
+		}
+		if h.Key == "" {
+			h.Key = inv.Defaults.Key
+		}
+		h.Key = expandHome(h.Key)
+		if h.Port == 0 {
+			h.Port = inv.Defaults.Port
+		}
+		if h.Port == 0 {
+			h.Port = 22
+		}
+		if h.Cluster == "" {
+			h.Cluster = h.Role
+		}
+	}
+	if err := inv.Validate(path); err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+// Validate checks the inventory, file is used in the error only.
+func (inv *Inventory) Validate(file string) error {
+	problems := []string{}
+	names := map[string]bool{}
+	roles := map[string]int{}
+	for i, h := range inv.Hosts {
+		name := h.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+			problems = append(problems, fmt.Sprintf("host %s: name is required", name))
+		} else if names[name] {
+			problems = append(problems, fmt.Sprintf("host %s: duplicate name", name))
+		}
+		names[name] = true
+		if h.Address == "" {
+			problems = append(problems, fmt.Sprintf("host %s: address is required", name))
+		}
+		if !contains(inventoryRoles, h.Role) {
+			problems = append(problems, fmt.Sprintf("host %s: unknown role '%s', expected one of: %s",
+				name, h.Role, strings.Join(inventoryRoles, ", ")))
+		}
+		roles[h.Role]++
+		if h.Cluster != h.Role && h.Role != RoleDownstream {
+			problems = append(problems, fmt.Sprintf("host %s: cluster can be set for downstream hosts only", name))
+		} else if h.Role == RoleDownstream && (h.Cluster == RoleUpstream || h.Cluster == RoleTester) {
+			problems = append(problems, fmt.Sprintf("host %s: cluster name '%s' is reserved", name, h.Cluster))
+		}
+		if h.Key != "" {
+			if _, err := os.Stat(h.Key); err != nil {
+				problems = append(problems, fmt.Sprintf("host %s: key: %v", name, err))
+			}
+		}
+		if h.Port < 0 || h.Port > 65535 {
+			problems = append(problems, fmt.Sprintf("host %s: invalid port %d", name, h.Port))
+		}
+	}
+	for _, role := range []string{RoleUpstream, RoleTester} {
+		if roles[role] == 0 {
+			problems = append(problems, fmt.Sprintf("no %s host", role))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("Invalid inventory %s:\n  - %s", file, strings.Join(problems, "\n  - "))
+	}
+	return nil
+}
+
+func inventoryCluster(name string, hosts []InventoryHost) map[string]any {
+	nodes := []any{}
+	for _, h := range hosts {
+		nodes = append(nodes, map[string]any{
+			"name":                 h.Name,
+			"address":              h.Address,
+			"ssh_user":             h.User,
+			"ssh_private_key_path": h.Key,
+			"ssh_port":             h.Port,
+		})
+	}
+	return map[string]any{"name": name, "hosts": nodes}
+}
+
+/**
+ * TerraformVars: variables of the ssh terraform configuration for the hosts.
+ *
+ * They replace the example var file of the ssh kind, downstream clusters are
+ * sorted by name.
+ */
+func (inv *Inventory) TerraformVars() map[string]any {
+	clusters := map[string][]InventoryHost{}
+	for _, h := range inv.Hosts {
+		clusters[h.Cluster] = append(clusters[h.Cluster], h)
+	}
+	downstream := []string{}
+	for _, h := range inv.Hosts {
+		if h.Role == RoleDownstream && !contains(downstream, h.Cluster) {
+			downstream = append(downstream, h.Cluster)
+		}
+	}
+	sort.Strings(downstream)
+	downstreamClusters := []any{}
+	for _, name := range downstream {
+		downstreamClusters = append(downstreamClusters, inventoryCluster(name, clusters[name]))
+	}
+	return map[string]any{
+		"upstream_cluster":    inventoryCluster(RoleUpstream, clusters[RoleUpstream]),
+		"tester_cluster":      inventoryCluster(RoleTester, clusters[RoleTester]),
+		"downstream_clusters": downstreamClusters,
+	}
+}
+
+// applyInventory makes the deployment use hosts of the inventory file.
+func (d *ScalabilityDeployment) applyInventory(path string) error {
+	if !d.kind().Inventory {
+		return fmt.Errorf("Inventory is not supported by the %s deployment type", d.Kind)
+	}
+	inv, err := LoadInventory(path)
+	if err != nil {
+		return err
+	}
+	d.Inventory = inv
+	d.TerraformVarFile = ""
+	if d.TerraformVars == nil {
+		d.TerraformVars = map[string]any{}
+	}
+	for k, v := range inv.TerraformVars() {
+		d.TerraformVars[k] = v
+	}
+	return nil
+}
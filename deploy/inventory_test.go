@@ -0,0 +1,165 @@
+package deploy
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeInventory(t *testing.T, data string) string {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "id_ed25519"), []byte("key"), 0600))
+	path := filepath.Join(dir, "hosts.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(data), 0644))
+	return path
+}
+
+const testInventory = `
+defaults:
+  user: ubuntu
+  key: KEY
+hosts:
+  - name: up1
+    address: 10.0.0.1
+    role: upstream
+  - name: tester
+    address: 10.0.0.2
+    role: tester
+    port: 2222
+  - name: ds1
+    address: 10.0.0.3
+    user: root
+    role: downstream
+    cluster: downstream-b
+  - name: ds2
+    address: 10.0.0.4
+    role: downstream
+    cluster: downstream-a
+`
+
+func newTestInventory(t *testing.T) string {
+	path := writeInventory(t, "")
+	key := filepath.Join(filepath.Dir(path), "id_ed25519")
+	assert.NoError(t, os.WriteFile(path, []byte(strings.ReplaceAll(testInventory, "KEY", key)), 0644))
+	return path
+}
+
+func TestLoadInventory(t *testing.T) {
+	path := newTestInventory(t)
+	inv, err := LoadInventory(path)
+	assert.NoError(t, err)
+	assert.Equal(t, InventoryHost{Name: "tester", Address: "10.0.0.2", User: "ubuntu",
+		Key: filepath.Join(filepath.Dir(path), "id_ed25519"), Port: 2222, Role: RoleTester, Cluster: RoleTester},
+		inv.Hosts[1])
+	assert.Equal(t, "root", inv.Hosts[2].User)
+	assert.Equal(t, 22, inv.Hosts[2].Port)
+
+	vars := inv.TerraformVars()
+	assert.Equal(t, "upstream", vars["upstream_cluster"].(map[string]any)["name"])
+	downstream := vars["downstream_clusters"].([]any)
+	assert.Len(t, downstream, 2)
+	assert.Equal(t, "downstream-a", downstream[0].(map[string]any)["name"])
+	host := downstream[1].(map[string]any)["hosts"].([]any)[0].(map[string]any)
+	assert.Equal(t, "10.0.0.3", host["address"])
+	assert.Equal(t, "root", host["ssh_user"])
+
+	_, err = LoadInventory(writeInventory(t, `
+hosts:
+  - name: a
+    role: upstream
+    key: /missing/key
+  - name: a
+    address: 10.0.0.1
+    role: database
+  - name: b
+    address: 10.0.0.2
+    role: upstream
+    cluster: main
+  - name: c
+    address: 10.0.0.3
+    role: downstream
+    cluster: tester
+`))
+	assert.ErrorContains(t, err, "host a: address is required")
+	assert.ErrorContains(t, err, "host a: key:")
+	assert.ErrorContains(t, err, "host a: duplicate name")
+	assert.ErrorContains(t, err, "host a: unknown role 'database'")
+	assert.ErrorContains(t, err, "host b: cluster can be set for downstream hosts only")
+	assert.ErrorContains(t, err, "host c: cluster name 'tester' is reserved")
+	assert.ErrorContains(t, err, "no tester host")
+}
+
+func TestMakeDeploymentInventory(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	InventoryFile = newTestInventory(t)
+	defer func() { InventoryFile = "" }()
+	md, err := MakeDeployment("test", testKind(t, "ssh"))
+	assert.NoError(t, err)
+	d := md.(ScalabilityDeployment)
+	assert.Equal(t, "", d.TerraformVarFile)
+	assert.Len(t, d.Inventory.Hosts, 4)
+	assert.Contains(t, d.TerraformVars, "upstream_cluster")
+
+	_, err = MakeDeployment("test", testKind(t, "k3d"))
+	assert.ErrorContains(t, err, "Inventory is not supported by the k3d deployment type")
+}
+
+// testPreflightOk is a 4GiB VM, MemTotal is lower than the memory of the VM
+const testPreflightOk = "os=ubuntu 22.04\ncpus=2\nmemory_kb=3995000\ndisk_kb=104857600\n"
+
+func TestPreflight(t *testing.T) {
+	d, f := newTestDeployment(t)
+	inv, err := LoadInventory(newTestInventory(t))
+	assert.NoError(t, err)
+	d.Kind = "ssh"
+	d.Inventory = inv
+	f.On(`^ssh .* 'ubuntu@10\.0\.0\.1'`, testPreflightOk, 0).
+		On(`^ssh .* -p 2222 .*'ubuntu@10\.0\.0\.2'`, "os=alpine 3.18\ncpus=1\nmemory_kb=1024000\ndisk_kb=1048576\nbusy_port=443\n", 0).
+		On(`^ssh .* 'root@10\.0\.0\.3'`, "", 255).
+		On(`^ssh .* 'ubuntu@10\.0\.0\.4'`, testPreflightOk, 0)
+
+	_, err = d.Make(context.Background())
+	var preflightErr *PreflightError
+	assert.True(t, errors.As(err, &preflightErr))
+	assert.Len(t, preflightErr.Failed, 2)
+	assert.ErrorContains(t, err, "Preflight checks failed on 2 host(s)")
+	assert.ErrorContains(t, err, "tester (ubuntu@10.0.0.2): unsupported OS 'alpine 3.18', 1 CPUs < 2, "+
+		"1000MiB memory < 3584MiB, 1GiB free disk < 20GiB, port 443 is in use")
+	assert.ErrorContains(t, err, "ds1 (root@10.0.0.3): unreachable over ssh")
+	assert.Len(t, f.Matching(`^terraform .* apply`), 0)
+	assert.Len(t, f.Matching(`^ssh -o BatchMode=yes .* -i '.*/id_ed25519' `), 4)
+
+	f = newTestExecutor().On(`^ssh `, testPreflightOk, 0)
+	d.Executor = f
+	Resume = true
+	defer func() { Resume = false }()
+	assert.NoError(t, d.Run(context.Background()))
+	assert.Len(t, f.Matching(`^terraform .* apply`), 1)
+	assert.Len(t, f.Matching(`(?s)^ssh .*for port in 80 443 6443 10250;`), 4)
+}
+
+func TestPreflightResume(t *testing.T) {
+	d, _ := newTestDeployment(t)
+	inv, err := LoadInventory(newTestInventory(t))
+	assert.NoError(t, err)
+	d.Kind = "ssh"
+	d.Inventory = inv
+	// k3s of the interrupted apply listens on the upstream host
+	state := `{"resources": [{"instances": [{"attributes": {"host": "10.0.0.1"}}]}]}`
+	assert.NoError(t, os.WriteFile(d.getTerraformStatePath(), []byte(state), 0644))
+	f := newTestExecutor().On(`(?s)'ubuntu@10\.0\.0\.[19]' .*for port in`, testPreflightOk+"busy_port=6443\n", 0).
+		On(`^ssh `, testPreflightOk, 0)
+	d.Executor = f
+
+	assert.NoError(t, preflight(context.Background(), d))
+	assert.Len(t, f.Matching(`^ssh `), 4)
+	assert.Len(t, f.Matching(`(?s)'ubuntu@10\.0\.0\.1' .*for port in`), 0)
+
+	d.Inventory.Hosts[0].Address = "10.0.0.9"
+	assert.ErrorContains(t, preflight(context.Background(), d), "up1 (ubuntu@10.0.0.9): port 6443 is in use")
+}
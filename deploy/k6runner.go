@@ -0,0 +1,105 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"soil/util"
+)
+
+// K6Runner selects where `so test` runs k6, one of util.K6Runners.
+var K6Runner = util.K6RunnerPod
+
+// K6NoRecord disables sending k6 metrics to mimir for all tests.
+var K6NoRecord bool
+
+// k6Runner runs tests of a suite by the selected runner.
+type k6Runner struct {
+	runner   string
+	r        util.Runner
+	tester   Cluster
+	upstream Cluster
+	local    util.K6Local
+	stop     func()
+}
+
+func validateK6Runner(runner string) error {
+	if !contains(util.K6Runners, runner) {
+		return fmt.Errorf("Unknown k6 runner '%s', expected one of: %s", runner, strings.Join(util.K6Runners, ", "))
+	}
+	return nil
+}
+
+func recordsMetrics(suite *Suite) bool {
+	for _, t := range suite.Tests {
+		if t.Record {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+ * newK6Runner prepares the runner for tests of the suite.
+ *
+ * The pod runner refreshes k6 files in the tester cluster, local runners use
+ * scripts of the local repo and reach mimir by kubectl port-forward.
+ */
+func (d ScalabilityDeployment) newK6Runner(ctx context.Context, suite *Suite, outputs *TerraformOutputs) (*k6Runner, error) {
+	k := &k6Runner{runner: K6Runner, r: d.run(), tester: outputs.Tester(), upstream: outputs.Upstream(), stop: func() {}}
+	if k.runner == util.K6RunnerPod {
+		// Refresh k6 files on the tester cluster
+		if err := d.helmInstall(ctx, "k6-files", d.getChartsDir()+"/k6-files", k.tester, "tester", nil); err != nil {
+			return nil, err
+		}
+		return k, nil
+	}
+	k.local = util.K6Local{Dir: d.getRepoLocalPath(), Docker: k.runner == util.K6RunnerDocker}
+	tool := "k6"
+	if k.local.Docker {
+		tool = "docker"
+	}
+	if _, err := d.run().ShellQuietOutput(ctx, tool+" version"); err != nil {
+		return nil, fmt.Errorf("%s is required by k6 runner '%s', please install it: %w", tool, k.runner, err)
+	}
+	if recordsMetrics(suite) && !K6NoRecord {
+		port, stop, err := d.run().PortForward(ctx, k.tester.Access(), "tester", "svc/mimir", MIMIR_PORT)
+		if err != nil {
+			return nil, stepError("kubectl port-forward svc/mimir", err)
+		}
+		k.stop = stop
+		k.local.MimirUrl = fmt.Sprintf("http://127.0.0.1:%d/mimir", port)
+	}
+	return k, nil
+}
+
+// close stops port-forwarding started for the runner.
+func (k *k6Runner) close() {
+	k.stop()
+}
+
+// urls returns URLs of rancher and kubernetes API of the cluster reachable by k6.
+func (k *k6Runner) urls(ctx context.Context, cluster Cluster) (string, string, error) {
+	if k.runner == util.K6RunnerPod {
+		return "https://" + k.upstream.PrivateName + ":443", "https://" + cluster.PrivateName + ":6443", nil
+	}
+	apiUrl, err := k.r.KubeApiServer(ctx, cluster.Access())
+	if err != nil {
+		return "", "", stepError("kubectl config view "+cluster.Name, err)
+	}
+	return k.upstream.LocalUrl(), strings.TrimSpace(apiUrl), nil
+}
+
+// run runs the k6 script in the pods, record is ignored if K6NoRecord is set.
+func (k *k6Runner) run(ctx context.Context, env map[string]string, tags map[string]string, script string, record bool, pods int) (*util.K6Summary, error) {
+	record = record && !K6NoRecord
+	if k.runner == util.K6RunnerPod {
+		return k.r.K6RunPods(ctx, k.tester.Access(), env, tags, script, record, pods)
+	}
+	if pods > 1 {
+		log.Printf("k6 runner '%s' runs a single k6 instance, ignoring pods: %d", k.runner, pods)
+	}
+	return k.r.K6RunLocal(ctx, k.local, env, tags, script, record)
+}
@@ -0,0 +1,87 @@
+package deploy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"soil/util"
+)
+
+func setK6Runner(t *testing.T, runner string, noRecord bool) {
+	K6Runner, K6NoRecord = runner, noRecord
+	t.Cleanup(func() { K6Runner, K6NoRecord = util.K6RunnerPod, false })
+}
+
+func TestScalabilityDeploymentTestLocalRunner(t *testing.T) {
+	d, f := newTestDeployment(t)
+	f.On(`^kubectl config view --minify`, "https://0.0.0.0:6550\n", 0)
+	setK6Runner(t, util.K6RunnerLocal, false)
+	assert.NoError(t, d.Test(context.Background()))
+
+	assert.Len(t, f.Matching(`^kubectl run k6 `), 0)
+	assert.Len(t, f.Matching(`k6-files`), 0)
+	assert.Len(t, f.Matching(`^kubectl port-forward --namespace=tester svc/mimir`), 1)
+	runs := f.Matching(`^cd '.*/scalability-tests' && 'K6_PROMETHEUS_RW_SERVER_URL=http://127.0.0.1:\d+/mimir/api/v1/push' .* k6 run `)
+	assert.Len(t, runs, 3)
+	assert.Contains(t, runs[0], "'BASE_URL=https://0.0.0.0:6550'")
+	assert.Contains(t, runs[0], "'KUBECONFIG=/tmp/downstream.yaml'")
+	assert.Contains(t, runs[0], "-o experimental-prometheus-rw")
+	assert.Contains(t, runs[1], "'BASE_URL=https://upstream.local.gd:8444'")
+}
+
+func TestScalabilityDeploymentTestDockerRunner(t *testing.T) {
+	d, f := newTestDeployment(t)
+	setK6Runner(t, util.K6RunnerDocker, true)
+	assert.NoError(t, d.Test(context.Background()))
+
+	assert.Len(t, f.Matching(`^kubectl port-forward`), 0)
+	runs := f.Matching(`^docker run --rm -i --network=host -v '.*/scalability-tests:/scripts:ro' `)
+	assert.Len(t, runs, 3)
+	assert.Contains(t, runs[0], "-v '/tmp/downstream.yaml:/kube/config:ro'")
+	assert.Contains(t, runs[0], "'KUBECONFIG=/kube/config'")
+	assert.NotContains(t, runs[0], "experimental-prometheus-rw")
+}
+
+func TestScalabilityDeploymentTestRunnerErrors(t *testing.T) {
+	d, f := newTestDeployment(t)
+	setK6Runner(t, "cloud", false)
+	assert.ErrorContains(t, d.Test(context.Background()), "Unknown k6 runner 'cloud'")
+
+	setK6Runner(t, util.K6RunnerLocal, false)
+	f.On(`^k6 version`, "", 127)
+	assert.ErrorContains(t, d.Test(context.Background()), "k6 is required by k6 runner 'local'")
+}
+
+func TestScalabilityDeploymentTestPods(t *testing.T) {
+	d, f := newTestDeployment(t)
+	suite := `
+name: distributed
+tests:
+  - name: load
+    script: k6/load.js
+    clusters: upstream
+    pods: 3
+`
+	path := filepath.Join(t.TempDir(), "distributed.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(suite), 0644))
+	SuiteName = path
+	defer func() { SuiteName = "" }()
+	f.On(`^kubectl run k6-1 `, "", 99)
+	err := d.Test(context.Background())
+	assert.ErrorContains(t, err, "pod k6-1")
+	assert.NotContains(t, err.Error(), "pod k6-0")
+
+	runs := f.Matching(`^kubectl run k6-\d `)
+	assert.Len(t, runs, 3)
+	for _, run := range runs {
+		assert.Contains(t, run, "--tty=false")
+		assert.Contains(t, run, "--execution-segment-sequence=0,1/3,2/3,1")
+		assert.Regexp(t, `run_id=\d{8}-\d{6}`, run)
+	}
+	assert.Len(t, f.Matching(`^kubectl run k6-0 .*--execution-segment=0:1/3`), 1)
+	assert.Len(t, f.Matching(`^kubectl run k6-2 .*--execution-segment=2/3:1`), 1)
+	assert.Len(t, f.Matching(`^kubectl --namespace=tester delete pod k6-\d --ignore-not-found`), 6)
+}
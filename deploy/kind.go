@@ -1,35 +1,189 @@
 package deploy
 
-import "reflect"
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
 
+	"soil/util"
+)
+
+// DEFAULT_REPLICAS is the number of rancher replicas of kinds not declaring it.
+const DEFAULT_REPLICAS = 3
+
+// Tool is an external command required by a kind.
+type Tool struct {
+	Name string
+	// Check is a shell command printing the version of the tool
+	Check string
+	// Version extracts the version from the output of Check, trimmed output if nil
+	Version func(output string) string
+	// Install is a hint logged if the tool is missing
+	Install string
+}
+
+// Kind is a type of deployment environment, see RegisterKind.
 type Kind struct {
-	Type             reflect.Type
-	Name             string
+	Name        string
+	Description string
+	// TerraformWorkDir is the terraform module of the kind in the scalability-tests repo
 	TerraformWorkDir string
+	// TerraformVarFile is the default var file, relative to the repo if it starts with /
 	TerraformVarFile string
 	TerraformRepoRef string
+	// Tools must be installed to deploy the kind
+	Tools []Tool
+	// Replicas is the default number of rancher replicas, DEFAULT_REPLICAS if zero
+	Replicas int
+	// MonitoringRestrictions are nodeSelector and tolerations of the upstream
+	// monitoring workloads, if the clusters reserve nodes for them
+	MonitoringRestrictions map[string]any
+	// Provider creates clusters of the kind, terraform if nil
+	Provider ClusterProvider
+	// Plugin is set for kinds provided by so-kind-NAME executables
+	Plugin bool
+	// Inventory is set for kinds installing clusters to hosts of --inventory,
+	// see Inventory.TerraformVars
+	Inventory bool
+	// PreApply hooks run before clusters are created, in the terraform phase
+	PreApply []func(context.Context, ScalabilityDeployment) error
+	// PostApply hooks run after clusters are created, in the terraform phase
+	PostApply []func(context.Context, ScalabilityDeployment) error
 }
 
-var KindMap = map[string]Kind{
-	"k3d": {
-		Name:             "k3d",
-		Type:             reflect.TypeOf(ScalabilityDeployment{}),
-		TerraformWorkDir: "terraform/main/k3d",
-		TerraformVarFile: "",
-		TerraformRepoRef: "",
-	},
-	"ssh": {
-		Name:             "ssh",
-		Type:             reflect.TypeOf(ScalabilityDeployment{}),
-		TerraformWorkDir: "terraform/main/ssh",
-		TerraformVarFile: "/terraform/examples/ssh.tfvars.json",
-		TerraformRepoRef: "",
+var kinds = map[string]Kind{}
+
+/**
+ * RegisterKind: make the kind available to `so deploy -t` and Soilfiles.
+ *
+ * Kinds register themselves from init functions of their files, e.g. kind_k3d.go.
+ */
+func RegisterKind(k Kind) {
+	if _, ok := kinds[k.Name]; ok {
+		panic(fmt.Sprintf("kind '%s' is already registered", k.Name))
+	}
+	kinds[k.Name] = k
+}
+
+// KindNames returns names of registered kinds and kind plugins on PATH, sorted.
+func KindNames() []string {
+	names := []string{}
+	for name := range kinds {
+		names = append(names, name)
+	}
+	for _, name := range kindPluginNames() {
+		if _, ok := kinds[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// lookupKind returns the registered kind of the name, or the kind of the
+// so-kind-NAME plugin on PATH.
+func lookupKind(name string) (Kind, bool) {
+	if k, ok := kinds[name]; ok {
+		return k, true
+	}
+	return lookupKindPlugin(name)
+}
+
+// LookupKind returns the kind of the name, see lookupKind.
+func LookupKind(name string) (Kind, error) {
+	k, ok := lookupKind(name)
+	if !ok {
+		return Kind{}, fmt.Errorf("Unknown deployment type '%s', expected one of: %s",
+			name, strings.Join(KindNames(), ", "))
+	}
+	return k, nil
+}
+
+// kind returns the kind of the deployment, terraform tools are required by
+// kinds which are no longer available. Kinds of plugins missing on PATH have
+// no provider, see provider.
+func (d ScalabilityDeployment) kind() Kind {
+	if d.KindPlugin {
+		if k, ok := lookupKindPlugin(d.Kind); ok {
+			return k
+		}
+		return Kind{Name: d.Kind, Plugin: true}
+	}
+	if k, ok := lookupKind(d.Kind); ok {
+		return k
+	}
+	return Kind{Name: d.Kind, Tools: terraformTools}
+}
+
+// checkTools logs versions of the tools, it returns false if any is missing.
+func checkTools(ctx context.Context, r util.Runner, tools []Tool) bool {
+	result := true
+	for _, t := range tools {
+		output, err := r.ShellQuietOutput(ctx, t.Check)
+		if err != nil {
+			msg := fmt.Sprintf("Error: no %s found", t.Name)
+			if t.Install != "" {
+				msg += ", " + t.Install
+			}
+			log.Print(msg)
+			result = false
+			continue
+		}
+		version := strings.TrimSpace(output)
+		if t.Version != nil {
+			version = t.Version(output)
+		}
+		log.Printf("Found %s version: %s", t.Name, version)
+	}
+	return result
+}
+
+func jsonField(field string) func(string) string {
+	return func(output string) string {
+		m := map[string]any{}
+		json.Unmarshal([]byte(output), &m)
+		return fmt.Sprint(m[field])
+	}
+}
+
+var ToolGit = Tool{Name: "git", Check: "git --version",
+	Version: func(output string) string { return util.SplitLast(strings.TrimSpace(output), " ") },
+	Install: "please install git"}
+
+var ToolKubectl = Tool{Name: "kubectl", Check: "kubectl version --client=true -o=json 2>/dev/null",
+	Version: jsonField("kustomizeVersion"), Install: "please install kubectl"}
+
+var ToolTerraform = Tool{Name: "terraform", Check: "terraform version -json",
+	Version: jsonField("terraform_version"),
+	Install: "please install terraform from https://releases.hashicorp.com/terraform/"}
+
+var ToolHelm = Tool{Name: "helm", Check: "helm version --template='{{.Version}}'",
+	Install: "try:\n" +
+		"    curl https://raw.githubusercontent.com/helm/helm/main/scripts/get-helm-3 | bash\n" +
+		"or:\n" +
+		"    curl https://raw.githubusercontent.com/helm/helm/main/scripts/get-helm-3 | " +
+		"HELM_INSTALL_DIR=$HOME/bin USE_SUDO=false bash"}
+
+var ToolDocker = Tool{Name: "docker", Check: "docker version --format '{{.Server.Version}}'",
+	Install: "please install docker and make sure the daemon is running"}
+
+// terraformTools are required by kinds created by terraform of the scalability-tests repo.
+var terraformTools = []Tool{ToolGit, ToolKubectl, ToolTerraform, ToolHelm}
+
+// monitoringNodeRestrictions schedule monitoring to nodes labeled and
+// tainted with monitoring.
+var monitoringNodeRestrictions = map[string]any{
+	"nodeSelector": map[string]any{
+		"monitoring": "true",
 	},
-	"aws": {
-		Name:             "aws",
-		Type:             reflect.TypeOf(ScalabilityDeployment{}),
-		TerraformWorkDir: "terraform/main/aws",
-		TerraformVarFile: "",
-		TerraformRepoRef: "",
+	"tolerations": []any{
+		map[string]any{
+			"key":      "monitoring",
+			"operator": "Exists",
+			"effect":   "NoSchedule",
+		},
 	},
 }
@@ -0,0 +1,17 @@
+package deploy
+
+import "strings"
+
+var ToolAws = Tool{Name: "aws cli", Check: "aws --version",
+	Version: func(output string) string { return strings.Split(strings.TrimSpace(output), " ")[0] },
+	Install: "please install aws, for details refer: " +
+		"https://docs.aws.amazon.com/cli/latest/userguide/getting-started-install.html"}
+
+func init() {
+	RegisterKind(Kind{
+		Name:             "aws",
+		Description:      "clusters on AWS EC2 instances",
+		TerraformWorkDir: "terraform/main/aws",
+		Tools:            append(append([]Tool{}, terraformTools...), ToolAws),
+	})
+}
@@ -0,0 +1,12 @@
+package deploy
+
+func init() {
+	RegisterKind(Kind{
+		Name:                   "k3d",
+		Description:            "local k3d clusters created by terraform",
+		TerraformWorkDir:       "terraform/main/k3d",
+		Tools:                  terraformTools,
+		Replicas:               1,
+		MonitoringRestrictions: monitoringNodeRestrictions,
+	})
+}
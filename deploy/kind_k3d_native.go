@@ -0,0 +1,165 @@
+package deploy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
+var ToolK3d = Tool{Name: "k3d", Check: "k3d version",
+	Install: "please install k3d from https://k3d.io/#installation"}
+
+func init() {
+	RegisterKind(Kind{
+		Name:                   "k3d-native",
+		Description:            "local k3d clusters created by soil without terraform",
+		Tools:                  []Tool{ToolGit, ToolKubectl, ToolHelm, ToolDocker, ToolK3d},
+		Replicas:               1,
+		MonitoringRestrictions: monitoringNodeRestrictions,
+		Provider:               k3dProvider{},
+	})
+}
+
+// k3dProvider creates local clusters by k3d, see localClusters.
+type k3dProvider struct{}
+
+// k3dNetwork is the docker network shared by clusters of the deployment.
+func (d ScalabilityDeployment) k3dNetwork() string {
+	return "soil-" + d.Name
+}
+
+/**
+ * k3dConfig: the k3d configuration of the cluster of the name.
+ *
+ * Traefik of k3s serves http and https ports of the load balancer, which are
+ * mapped to the host. The monitoring agent is the last one.
+ */
+func k3dConfig(name string, network string, c localCluster) map[string]any {
+	agents := c.Agents
+	k3s := map[string]any{}
+	if c.Monitoring {
+		monitoring := []any{fmt.Sprintf("agent:%d", agents)}
+		k3s["nodeLabels"] = []any{
+			map[string]any{"label": "monitoring=true", "nodeFilters": monitoring},
+		}
+		k3s["extraArgs"] = []any{
+			map[string]any{"arg": "--node-taint=monitoring=true:NoSchedule", "nodeFilters": monitoring},
+		}
+		agents++
+	}
+	return map[string]any{
+		"apiVersion": "k3d.io/v1alpha5",
+		"kind":       "Simple",
+		"metadata":   map[string]any{"name": name},
+		"servers":    1,
+		"agents":     agents,
+		"network":    network,
+		"ports": []any{
+			map[string]any{"port": fmt.Sprintf("%d:80", c.HttpPort), "nodeFilters": []any{"loadbalancer"}},
+			map[string]any{"port": fmt.Sprintf("%d:443", c.HttpsPort), "nodeFilters": []any{"loadbalancer"}},
+		},
+		"options": map[string]any{
+			"k3d": map[string]any{"wait": true},
+			"k3s": k3s,
+			"kubeconfig": map[string]any{
+				"updateDefaultKubeconfig": false,
+				"switchCurrentContext":    false,
+			},
+		},
+	}
+}
+
+func (k3dProvider) Requirements(ctx context.Context, d ScalabilityDeployment) []string {
+	if _, err := d.localClusters(); err != nil {
+		return []string{err.Error()}
+	}
+	return nil
+}
+
+/**
+ * Create: create clusters which do not exist yet and write their kubeconfigs.
+ */
+func (k3dProvider) Create(ctx context.Context, d ScalabilityDeployment) error {
+	clusters, err := d.localClusters()
+	if err != nil {
+		return err
+	}
+	output, err := d.run().ShellQuietOutput(ctx, "k3d cluster list -o json")
+	if err != nil {
+		return stepError("k3d cluster list", err)
+	}
+	var list []struct {
+		Name string `json:"name"`
+	}
+	if output != "" {
+		if err := json.Unmarshal([]byte(output), &list); err != nil {
+			return fmt.Errorf("Invalid output of k3d cluster list: %w", err)
+		}
+	}
+	existing := []string{}
+	for _, c := range list {
+		existing = append(existing, c.Name)
+	}
+	for _, c := range clusters {
+		name := d.localClusterName(c)
+		if contains(existing, name) {
+			log.Printf("Cluster %s exists, writing kubeconfig", name)
+		} else {
+			path, err := d.writeLocalConfig("k3d-"+c.Name+".yaml", k3dConfig(name, d.k3dNetwork(), c))
+			if err != nil {
+				return err
+			}
+			if _, err := d.run().Exec(ctx, "k3d", "cluster", "create", "--config", path); err != nil {
+				return stepError("k3d cluster create "+name, err)
+			}
+		}
+		_, err := d.run().Exec(ctx, "k3d", "kubeconfig", "write", name, "--output", d.localKubeconfig(c), "--overwrite")
+		if err != nil {
+			return stepError("k3d kubeconfig write "+name, err)
+		}
+	}
+	return nil
+}
+
+// k3dNodes returns docker exec commands of nodes of the cluster, named by k3d.
+func k3dNodes(name string, c localCluster) map[string]string {
+	containers := []string{"k3d-" + name + "-server-0"}
+	agents := c.Agents
+	if c.Monitoring {
+		agents++
+	}
+	for i := 0; i < agents; i++ {
+		containers = append(containers, fmt.Sprintf("k3d-%s-agent-%d", name, i))
+	}
+	nodes := map[string]string{}
+	for _, container := range containers {
+		nodes[container] = "docker exec -it " + container + " sh"
+	}
+	return nodes
+}
+
+/**
+ * Outputs: clusters reach each other by names of k3d load balancer containers
+ * in the docker network of the deployment.
+ */
+func (k3dProvider) Outputs(ctx context.Context, d ScalabilityDeployment) (*TerraformOutputs, error) {
+	return d.localOutputs(
+		func(c localCluster) string { return "k3d-" + d.localClusterName(c) },
+		func(c localCluster) string { return "k3d-" + d.localClusterName(c) + "-serverlb" },
+		func(c localCluster) map[string]string { return k3dNodes(d.localClusterName(c), c) })
+}
+
+func (k3dProvider) Destroy(ctx context.Context, d ScalabilityDeployment) error {
+	clusters, err := d.localClusters()
+	if err != nil {
+		return err
+	}
+	for _, c := range clusters {
+		name := d.localClusterName(c)
+		if _, err := d.run().Exec(ctx, "k3d", "cluster", "delete", name); err != nil {
+			return stepError("k3d cluster delete "+name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package deploy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestK3dNativeMake(t *testing.T) {
+	d := newTestKindDeployment(t, "k3d-native")
+	f := newTestExecutor().On(`^k3d cluster list -o json`, `[{"name": "test-tester"}]`, 0)
+	d.Executor = f
+	createKubeconfigs(t, d)
+	assert.True(t, d.CheckRequirements(context.Background()))
+	assert.Len(t, f.Matching(`^terraform`), 0)
+	assert.Len(t, f.Matching(`^k3d version`), 1)
+
+	_, err := d.Make(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, f.Matching(`^terraform`), 0)
+	assert.Len(t, f.Matching(`^k3d cluster create --config .*/k3d-tester.yaml`), 0)
+	assert.Len(t, f.Matching(`^k3d cluster create --config .*/k3d-(upstream|downstream-\d).yaml$`), 3)
+	assert.Len(t, f.Matching(`^k3d kubeconfig write test-\S+ --output .*\.kubeconfig --overwrite`), 4)
+	assert.Len(t, f.Matching(`^helm .* rancher https://releases.rancher.com/.*hostname="k3d-test-upstream-serverlb"`), 1)
+	assert.Len(t, f.Matching(`--kube-context=k3d-test-upstream .* rancher-monitoring .*"nodeSelector":\{"monitoring":"true"\}`), 1)
+
+	data, err := os.ReadFile(filepath.Join(d.Workdir(), "k3d-upstream.yaml"))
+	assert.NoError(t, err)
+	var config map[string]any
+	assert.NoError(t, yaml.Unmarshal(data, &config))
+	assert.Equal(t, 2, config["agents"])
+	assert.Equal(t, "soil-test", config["network"])
+	assert.Contains(t, string(data), "port: 8444:443")
+	assert.Contains(t, string(data), "arg: --node-taint=monitoring=true:NoSchedule")
+	assert.Contains(t, string(data), "- agent:1")
+
+	outputs, err := d.getOutputs(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 8081, outputs.Upstream().LocalHttpPort)
+	assert.Contains(t, outputs.Upstream().NodeAccessCommands, "k3d-test-upstream-agent-1")
+
+	assert.NoError(t, d.Remove(context.Background(), false))
+	assert.Len(t, f.Matching(`^k3d cluster delete test-`), 4)
+}
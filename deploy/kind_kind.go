@@ -0,0 +1,178 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// KIND_INGRESS_MANIFEST installs ingress-nginx to kind clusters, serving ports mapped to the host.
+const KIND_INGRESS_MANIFEST = "https://raw.githubusercontent.com/kubernetes/ingress-nginx/controller-v1.9.4/deploy/static/provider/kind/deploy.yaml"
+
+var ToolKind = Tool{Name: "kind", Check: "kind version",
+	Install: "please install kind from https://kind.sigs.k8s.io/docs/user/quick-start/#installation"}
+
+func init() {
+	RegisterKind(Kind{
+		Name:                   "kind",
+		Description:            "local Kubernetes-in-Docker clusters created by kind",
+		Tools:                  []Tool{ToolGit, ToolKubectl, ToolHelm, ToolDocker, ToolKind},
+		Replicas:               1,
+		MonitoringRestrictions: monitoringNodeRestrictions,
+		Provider:               kindProvider{},
+		PostApply:              []func(context.Context, ScalabilityDeployment) error{installKindIngress},
+	})
+}
+
+// kindProvider creates local clusters by kind, see localClusters.
+type kindProvider struct{}
+
+// kindConfig returns the kind configuration of the cluster of the name.
+func kindConfig(name string, c localCluster) map[string]any {
+	controlPlane := map[string]any{
+		"role": "control-plane",
+		// ingress-nginx runs on the node serving ports mapped to the host
+		"labels": map[string]any{"ingress-ready": "true"},
+		"extraPortMappings": []any{
+			map[string]any{"containerPort": 80, "hostPort": c.HttpPort, "protocol": "TCP"},
+			map[string]any{"containerPort": 443, "hostPort": c.HttpsPort, "protocol": "TCP"},
+		},
+		// workloads run on the control plane, which kind taints if there are workers
+		"kubeadmConfigPatches": []any{"kind: InitConfiguration\nnodeRegistration:\n  taints: []\n"},
+	}
+	nodes := []any{controlPlane}
+	for i := 0; i < c.Agents; i++ {
+		nodes = append(nodes, map[string]any{"role": "worker"})
+	}
+	if c.Monitoring {
+		nodes = append(nodes, map[string]any{
+			"role":   "worker",
+			"labels": map[string]any{"monitoring": "true"},
+			"kubeadmConfigPatches": []any{"kind: JoinConfiguration\nnodeRegistration:\n  taints:\n" +
+				"  - key: monitoring\n    value: \"true\"\n    effect: NoSchedule\n"},
+		})
+	}
+	return map[string]any{
+		"kind":       "Cluster",
+		"apiVersion": "kind.x-k8s.io/v1alpha4",
+		"name":       name,
+		"nodes":      nodes,
+	}
+}
+
+func (kindProvider) Requirements(ctx context.Context, d ScalabilityDeployment) []string {
+	if _, err := d.localClusters(); err != nil {
+		return []string{err.Error()}
+	}
+	return nil
+}
+
+/**
+ * Create: create clusters which do not exist yet and export their kubeconfigs.
+ */
+func (kindProvider) Create(ctx context.Context, d ScalabilityDeployment) error {
+	clusters, err := d.localClusters()
+	if err != nil {
+		return err
+	}
+	existing, err := d.run().ShellQuietOutput(ctx, "kind get clusters")
+	if err != nil {
+		return stepError("kind get clusters", err)
+	}
+	for _, c := range clusters {
+		name := d.localClusterName(c)
+		if contains(strings.Fields(existing), name) {
+			log.Printf("Cluster %s exists, exporting kubeconfig", name)
+			_, err := d.run().Exec(ctx, "kind", "export", "kubeconfig", "--name", name, "--kubeconfig", d.localKubeconfig(c))
+			if err != nil {
+				return stepError("kind export kubeconfig "+name, err)
+			}
+			continue
+		}
+		path, err := d.writeLocalConfig("kind-"+c.Name+".yaml", kindConfig(name, c))
+		if err != nil {
+			return err
+		}
+		_, err = d.run().Exec(ctx, "kind", "create", "cluster", "--config", path,
+			"--kubeconfig", d.localKubeconfig(c), "--wait", "5m")
+		if err != nil {
+			return stepError("kind create cluster "+name, err)
+		}
+	}
+	return nil
+}
+
+// kindNodes returns docker exec commands of nodes of the cluster, named by kind.
+func kindNodes(name string, c localCluster) map[string]string {
+	containers := []string{name + "-control-plane"}
+	workers := c.Agents
+	if c.Monitoring {
+		workers++
+	}
+	for i := 1; i <= workers; i++ {
+		if i == 1 {
+			containers = append(containers, name+"-worker")
+		} else {
+			containers = append(containers, fmt.Sprintf("%s-worker%d", name, i))
+		}
+	}
+	nodes := map[string]string{}
+	for _, container := range containers {
+		nodes[container] = "docker exec -it " + container + " bash"
+	}
+	return nodes
+}
+
+/**
+ * Outputs: clusters reach each other by names of control plane containers
+ * in the kind docker network.
+ */
+func (kindProvider) Outputs(ctx context.Context, d ScalabilityDeployment) (*TerraformOutputs, error) {
+	return d.localOutputs(
+		func(c localCluster) string { return "kind-" + d.localClusterName(c) },
+		func(c localCluster) string { return d.localClusterName(c) + "-control-plane" },
+		func(c localCluster) map[string]string { return kindNodes(d.localClusterName(c), c) })
+}
+
+func (kindProvider) Destroy(ctx context.Context, d ScalabilityDeployment) error {
+	clusters, err := d.localClusters()
+	if err != nil {
+		return err
+	}
+	for _, c := range clusters {
+		name := d.localClusterName(c)
+		_, err := d.run().Exec(ctx, "kind", "delete", "cluster", "--name", name, "--kubeconfig", d.localKubeconfig(c))
+		if err != nil {
+			return stepError("kind delete cluster "+name, err)
+		}
+	}
+	return nil
+}
+
+// installKindIngress installs ingress-nginx as the default ingress class of
+// every cluster, kind clusters have no ingress controller.
+func installKindIngress(ctx context.Context, d ScalabilityDeployment) error {
+	outputs, err := d.getOutputs(ctx)
+	if err != nil {
+		return err
+	}
+	r := d.run()
+	clusters := append([]Cluster{outputs.Tester(), outputs.Upstream()}, outputs.Downstream()...)
+	for _, c := range clusters {
+		if err := r.KubeCtl(ctx, c.Access(), "apply", "-f", KIND_INGRESS_MANIFEST); err != nil {
+			return stepError("kubectl apply ingress-nginx to "+c.Name, err)
+		}
+		err := r.KubeCtl(ctx, c.Access(), "--namespace=ingress-nginx", "wait", "--for=condition=ready", "pod",
+			"--selector=app.kubernetes.io/component=controller", "--timeout=5m")
+		if err != nil {
+			return stepError("kubectl wait ingress-nginx of "+c.Name, err)
+		}
+		err = r.KubeCtl(ctx, c.Access(), "annotate", "ingressclass", "nginx", "--overwrite",
+			"ingressclass.kubernetes.io/is-default-class=true")
+		if err != nil {
+			return stepError("kubectl annotate ingressclass of "+c.Name, err)
+		}
+	}
+	return nil
+}
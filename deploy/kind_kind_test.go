@@ -0,0 +1,95 @@
+package deploy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func newTestKindDeployment(t *testing.T, kind string) ScalabilityDeployment {
+	d, _ := newTestDeployment(t)
+	d.Kind = kind
+	d.RancherReplicas = 1
+	d.TerraformVars = map[string]any{DOWNSTREAM_COUNT_VAR: 2.0, UPSTREAM_AGENTS_VAR: 1}
+	return d
+}
+
+// createKubeconfigs creates kubeconfig files of local clusters, as done by the local tool.
+func createKubeconfigs(t *testing.T, d ScalabilityDeployment) {
+	clusters, err := d.localClusters()
+	assert.NoError(t, err)
+	for _, c := range clusters {
+		assert.NoError(t, os.WriteFile(d.localKubeconfig(c), []byte("{}"), 0600))
+	}
+}
+
+func TestLocalClusters(t *testing.T) {
+	d := newTestKindDeployment(t, "kind")
+	clusters, err := d.localClusters()
+	assert.NoError(t, err)
+	assert.Equal(t, []localCluster{
+		{Name: "tester", HttpPort: 8080, HttpsPort: 8443},
+		{Name: "upstream", Agents: 1, Monitoring: true, HttpPort: 8081, HttpsPort: 8444},
+		{Name: "downstream-0", HttpPort: 8082, HttpsPort: 8445},
+		{Name: "downstream-1", HttpPort: 8083, HttpsPort: 8446},
+	}, clusters)
+
+	d.TerraformVars[LOCAL_HTTP_PORT_VAR] = "nine"
+	_, err = d.localClusters()
+	assert.ErrorContains(t, err, "Invalid variable first_local_http_port")
+	d.TerraformVars[LOCAL_HTTP_PORT_VAR] = -1
+	_, err = d.localClusters()
+	assert.ErrorContains(t, err, "is negative")
+}
+
+func TestKindMake(t *testing.T) {
+	d := newTestKindDeployment(t, "kind")
+	f := newTestExecutor().On(`^kind get clusters`, "test-tester\n", 0)
+	d.Executor = f
+	createKubeconfigs(t, d)
+	_, err := d.Make(context.Background())
+	assert.NoError(t, err)
+
+	assert.Len(t, f.Matching(`^terraform`), 0)
+	assert.Len(t, f.Matching(`^kind export kubeconfig --name test-tester `), 1)
+	assert.Len(t, f.Matching(`^kind create cluster --config .*/kind-(upstream|downstream-\d).yaml --kubeconfig `), 3)
+	assert.Len(t, f.Matching(`^kubectl apply -f .*ingress-nginx.*--context=kind-test-`), 4)
+	assert.Len(t, f.Matching(`^helm .* rancher https://releases.rancher.com/.*hostname="test-upstream-control-plane"`), 1)
+	assert.Len(t, f.Matching(`--kubeconfig=.*/upstream.kubeconfig --kube-context=kind-test-upstream .* rancher-monitoring .*"nodeSelector":\{"monitoring":"true"\}`), 1)
+	assert.Len(t, f.Matching(`^kubectl apply -f .*/secret_c-m-abcdef.yaml --kubeconfig=.*/downstream-1.kubeconfig`), 1)
+
+	data, err := os.ReadFile(filepath.Join(d.Workdir(), "kind-upstream.yaml"))
+	assert.NoError(t, err)
+	var config struct {
+		Name  string `yaml:"name"`
+		Nodes []struct {
+			Role              string            `yaml:"role"`
+			Labels            map[string]string `yaml:"labels"`
+			ExtraPortMappings []map[string]any  `yaml:"extraPortMappings"`
+		} `yaml:"nodes"`
+	}
+	assert.NoError(t, yaml.Unmarshal(data, &config))
+	assert.Equal(t, "test-upstream", config.Name)
+	assert.Len(t, config.Nodes, 3)
+	assert.Equal(t, 8444, config.Nodes[0].ExtraPortMappings[1]["hostPort"])
+	assert.Equal(t, map[string]string{"monitoring": "true"}, config.Nodes[2].Labels)
+
+	outputs, err := d.getOutputs(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "upstream.local.gd", outputs.Upstream().LocalName)
+	assert.Contains(t, outputs.Upstream().NodeAccessCommands, "test-upstream-worker2")
+	assert.Len(t, outputs.Downstream(), 2)
+
+	assert.NoError(t, d.Remove(context.Background(), false))
+	assert.Len(t, f.Matching(`^kind delete cluster --name test-`), 4)
+}
+
+func TestKindOutputsMissing(t *testing.T) {
+	d := newTestKindDeployment(t, "kind")
+	_, err := d.getOutputs(context.Background())
+	assert.ErrorContains(t, err, "Cluster tester is not created")
+}
@@ -0,0 +1,17 @@
+package deploy
+
+import "context"
+
+var ToolSsh = Tool{Name: "ssh", Check: "ssh -V 2>&1", Install: "please install openssh client"}
+
+func init() {
+	RegisterKind(Kind{
+		Name:             "ssh",
+		Description:      "k3s clusters installed over ssh to existing hosts",
+		TerraformWorkDir: "terraform/main/ssh",
+		TerraformVarFile: "/terraform/examples/ssh.tfvars.json",
+		Tools:            append(append([]Tool{}, terraformTools...), ToolSsh),
+		Inventory:        true,
+		PreApply:         []func(context.Context, ScalabilityDeployment) error{preflight},
+	})
+}
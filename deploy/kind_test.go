@@ -0,0 +1,66 @@
+package deploy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"soil/util"
+)
+
+func testKind(t *testing.T, name string) Kind {
+	k, err := LookupKind(name)
+	assert.NoError(t, err)
+	return k
+}
+
+func TestLookupKind(t *testing.T) {
+	assert.Equal(t, []string{"aws", "k3d", "k3d-native", "kind", "ssh"}, KindNames())
+	assert.Equal(t, "terraform/main/ssh", testKind(t, "ssh").TerraformWorkDir)
+	_, err := LookupKind("vsphere")
+	assert.ErrorContains(t, err, "Unknown deployment type 'vsphere', expected one of: aws, k3d, k3d-native, kind, ssh")
+	assert.Panics(t, func() { RegisterKind(Kind{Name: "k3d"}) })
+}
+
+func TestCheckRequirements(t *testing.T) {
+	d, f := newTestDeployment(t)
+	f.On(`^terraform version`, `{"terraform_version": "1.5.7"}`, 0)
+	assert.True(t, d.CheckRequirements(context.Background()))
+	assert.Len(t, f.Matching(`^aws --version`), 0)
+
+	d.Kind = "aws"
+	f.On(`^aws --version`, "", 127)
+	assert.False(t, d.CheckRequirements(context.Background()))
+	assert.Len(t, f.Matching(`^aws --version`), 1)
+
+	f = util.NewFakeExecutor()
+	assert.True(t, checkTools(context.Background(), util.NewRunner(f), nil))
+}
+
+func TestKindPostApply(t *testing.T) {
+	name := "post-apply-test"
+	called := 0
+	RegisterKind(Kind{Name: name, TerraformWorkDir: "terraform/main/k3d",
+		PostApply: []func(context.Context, ScalabilityDeployment) error{
+			func(ctx context.Context, d ScalabilityDeployment) error {
+				called++
+				return nil
+			},
+		}})
+	defer delete(kinds, name)
+	d, _ := newTestDeployment(t)
+	d.Kind = name
+	assert.NoError(t, d.createClusters(context.Background()))
+	assert.Equal(t, 1, called)
+	assert.Equal(t, DEFAULT_REPLICAS, makeDeployment("test", kinds[name], nil).RancherReplicas)
+}
+
+func TestMonitoringRestrictions(t *testing.T) {
+	d, f := newTestDeployment(t)
+	assert.NoError(t, d.installUpstreamMonitoring(context.Background()))
+	assert.Len(t, f.Matching(`rancher-monitoring .*"nodeSelector":\{"monitoring":"true"\}`), 1)
+
+	d.Kind = "aws"
+	assert.NoError(t, d.installUpstreamMonitoring(context.Background()))
+	assert.Len(t, f.Matching(`rancher-monitoring .*"nodeSelector":null`), 1)
+}
@@ -0,0 +1,159 @@
+package deploy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+	"soil/util"
+)
+
+// Variables of kinds creating local clusters without terraform, set by
+// terraform.vars of the Soilfile like for terraform kinds.
+const (
+	// UPSTREAM_AGENTS_VAR is the number of agent nodes of the upstream cluster
+	UPSTREAM_AGENTS_VAR = "upstream_agent_count"
+	// DOWNSTREAM_AGENTS_VAR is the number of agent nodes of every downstream cluster
+	DOWNSTREAM_AGENTS_VAR = "downstream_agent_count"
+	// LOCAL_HTTP_PORT_VAR is the host port of http of the tester cluster, following clusters use next ports
+	LOCAL_HTTP_PORT_VAR = "first_local_http_port"
+	// LOCAL_HTTPS_PORT_VAR is the host port of https of the tester cluster, following clusters use next ports
+	LOCAL_HTTPS_PORT_VAR = "first_local_https_port"
+)
+
+// Defaults of local cluster variables
+const (
+	LOCAL_DOWNSTREAM_COUNT = 1
+	LOCAL_HTTP_PORT        = 8080
+	LOCAL_HTTPS_PORT       = 8443
+)
+
+// LOCAL_DOMAIN resolves any subdomain to 127.0.0.1.
+const LOCAL_DOMAIN = "local.gd"
+
+// localCluster is a cluster of a local kind, ports are mapped to the host
+// for http and https of the ingress controller.
+type localCluster struct {
+	Name      string
+	Agents    int
+	HttpPort  int
+	HttpsPort int
+	// Monitoring adds an agent labeled and tainted monitoring=true,
+	// see monitoringNodeRestrictions
+	Monitoring bool
+}
+
+// intVar returns the variable as int, vars loaded from the status file are float64.
+func intVar(vars map[string]any, name string, def int) (int, error) {
+	v, ok := vars[name]
+	if !ok {
+		return def, nil
+	}
+	switch n := v.(type) {
+	case int:
+		return n, nil
+	case float64:
+		return int(n), nil
+	case string:
+		if i, err := strconv.Atoi(n); err == nil {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("Invalid variable %s: %v is not a number", name, v)
+}
+
+/**
+ * localClusters: the tester, upstream and downstream clusters of a local kind.
+ *
+ * The layout is given by variables of the deployment, the upstream cluster
+ * reserves a node for monitoring like the k3d terraform configuration.
+ */
+func (d ScalabilityDeployment) localClusters() ([]localCluster, error) {
+	vars := map[string]int{
+		DOWNSTREAM_COUNT_VAR:  LOCAL_DOWNSTREAM_COUNT,
+		UPSTREAM_AGENTS_VAR:   0,
+		DOWNSTREAM_AGENTS_VAR: 0,
+		LOCAL_HTTP_PORT_VAR:   LOCAL_HTTP_PORT,
+		LOCAL_HTTPS_PORT_VAR:  LOCAL_HTTPS_PORT,
+	}
+	for name, def := range vars {
+		v, err := intVar(d.TerraformVars, name, def)
+		if err != nil {
+			return nil, err
+		}
+		if v < 0 {
+			return nil, fmt.Errorf("Invalid variable %s: %d is negative", name, v)
+		}
+		vars[name] = v
+	}
+	clusters := []localCluster{
+		{Name: "tester"},
+		{Name: "upstream", Agents: vars[UPSTREAM_AGENTS_VAR], Monitoring: true},
+	}
+	for i := 0; i < vars[DOWNSTREAM_COUNT_VAR]; i++ {
+		clusters = append(clusters, localCluster{Name: fmt.Sprintf("downstream-%d", i), Agents: vars[DOWNSTREAM_AGENTS_VAR]})
+	}
+	for i := range clusters {
+		clusters[i].HttpPort = vars[LOCAL_HTTP_PORT_VAR] + i
+		clusters[i].HttpsPort = vars[LOCAL_HTTPS_PORT_VAR] + i
+	}
+	return clusters, nil
+}
+
+// localClusterName is the name of the cluster for the local tool, unique among deployments.
+func (d ScalabilityDeployment) localClusterName(c localCluster) string {
+	return d.Name + "-" + c.Name
+}
+
+// localKubeconfig is the kubeconfig of the cluster in the workdir.
+func (d ScalabilityDeployment) localKubeconfig(c localCluster) string {
+	return filepath.Join(d.Workdir(), c.Name+".kubeconfig")
+}
+
+// writeLocalConfig saves configuration of the local tool to the file in the workdir.
+func (d ScalabilityDeployment) writeLocalConfig(file string, config map[string]any) (string, error) {
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(d.Workdir(), file)
+	if util.DryRun {
+		fmt.Printf("cat > %s <<EOF\n%s\nEOF\n", path, data)
+		return path, nil
+	}
+	return path, util.WriteFileAtomic(path, data, 0644)
+}
+
+/**
+ * localOutputs: outputs of the local clusters, which must have been created.
+ *
+ * context and privateName return the kubeconfig context and the name of the
+ * cluster reachable from other clusters, nodes returns node access commands.
+ */
+func (d ScalabilityDeployment) localOutputs(context func(localCluster) string, privateName func(localCluster) string,
+	nodes func(localCluster) map[string]string) (*TerraformOutputs, error) {
+	clusters, err := d.localClusters()
+	if err != nil {
+		return nil, err
+	}
+	o := &TerraformOutputs{Clusters: map[string]Cluster{}}
+	for _, c := range clusters {
+		kubeconfig := d.localKubeconfig(c)
+		if _, err := os.Stat(kubeconfig); os.IsNotExist(err) {
+			return nil, fmt.Errorf("Cluster %s is not created, kubeconfig does not exist: %s", c.Name, kubeconfig)
+		}
+		o.Clusters[c.Name] = Cluster{
+			Name:               c.Name,
+			LocalName:          c.Name + "." + LOCAL_DOMAIN,
+			PrivateName:        privateName(c),
+			Kubeconfig:         kubeconfig,
+			Context:            context(c),
+			LocalHttpPort:      c.HttpPort,
+			LocalHttpsPort:     c.HttpsPort,
+			NodeAccessCommands: nodes(c),
+		}
+	}
+	return o, nil
+}
@@ -0,0 +1,144 @@
+package deploy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"soil/util"
+	"time"
+)
+
+// WaitLock makes commands wait for a busy deployment instead of failing.
+var WaitLock bool
+
+// LOCK_POLL_INTERVAL is how often a busy deployment lock is checked.
+const LOCK_POLL_INTERVAL = time.Second
+
+// BusyError is returned when the deployment is locked by another process.
+type BusyError struct {
+	Name  string
+	Owner LockOwner
+}
+
+func (e *BusyError) Error() string {
+	return fmt.Sprintf("deployment '%s' is busy: '%s' is running by process %d on %s since %s",
+		e.Name, e.Owner.Command, e.Owner.PID, e.Owner.Hostname, formatTime(e.Owner.LockedAt))
+}
+
+// LockOwner describes the process holding a deployment lock.
+type LockOwner struct {
+	PID      int       `json:"pid"`
+	Hostname string    `json:"hostname"`
+	Command  string    `json:"command"`
+	LockedAt time.Time `json:"locked_at"`
+}
+
+// stale reports whether the lock owner is a process on this host
+// that does not exist anymore.
+func (o LockOwner) stale() bool {
+	hostname, _ := os.Hostname()
+	return o.Hostname == hostname && !util.ProcessAlive(o.PID)
+}
+
+func lockFile(name string) string {
+	return fmt.Sprintf("%s/%s.lock", deploymentsDir(), name)
+}
+
+func readLockOwner(path string) (o LockOwner, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(data, &o)
+	return
+}
+
+// tryLock creates the lock file with the owner, the lock file is linked
+// from a complete temporary file, so it is never seen partially written.
+func tryLock(path string, o LockOwner) error {
+	data, err := json.Marshal(o)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(deploymentsDir(), ".lock-*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Link(tmp, path)
+}
+
+/**
+ * LockDeployment: acquire an advisory lock of the deployment for the command.
+ *
+ * If the deployment is locked by a live process, BusyError is returned,
+ * or with WaitLock it waits until the lock is released or ctx is done.
+ * Locks left by processes that do not exist anymore are removed.
+ * Returns function releasing the lock.
+ */
+func LockDeployment(ctx context.Context, name string, command string) (unlock func(), err error) {
+	unlock = func() {}
+	if util.DryRun {
+		log.Printf("Dry run, skipping locking of deployment '%s'", name)
+		return
+	}
+	if err = os.MkdirAll(deploymentsDir(), 0755); err != nil {
+		return
+	}
+	path := lockFile(name)
+	hostname, _ := os.Hostname()
+	me := LockOwner{PID: os.Getpid(), Hostname: hostname, Command: command, LockedAt: time.Now().UTC()}
+	waiting := false
+	for {
+		err = tryLock(path, me)
+		if err == nil {
+			log.Printf("Locked deployment '%s'", name)
+			return func() {
+				if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+					log.Printf("Failed to unlock deployment '%s': %v", name, err)
+				}
+			}, nil
+		}
+		if !os.IsExist(err) {
+			return
+		}
+		owner, rerr := readLockOwner(path)
+		if os.IsNotExist(rerr) {
+			// released meanwhile
+			continue
+		}
+		if rerr != nil {
+			return unlock, fmt.Errorf("Invalid lock file '%s', remove it if no other so is running: %w", path, rerr)
+		}
+		if owner.stale() {
+			log.Printf("Removing stale lock of deployment '%s' left by process %d", name, owner.PID)
+			if err = os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return
+			}
+			continue
+		}
+		busy := &BusyError{Name: name, Owner: owner}
+		if !WaitLock {
+			return unlock, busy
+		}
+		if !waiting {
+			log.Printf("Waiting for lock: %v", busy)
+			waiting = true
+		}
+		select {
+		case <-ctx.Done():
+			return unlock, fmt.Errorf("%w: %v", ctx.Err(), busy)
+		case <-time.After(LOCK_POLL_INTERVAL):
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package deploy
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockDeploymentBusy(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	unlock, err := LockDeployment(context.Background(), "test", "deploy")
+	assert.NoError(t, err)
+
+	_, err = LockDeployment(context.Background(), "test", "remove")
+	var busy *BusyError
+	assert.ErrorAs(t, err, &busy)
+	assert.Equal(t, os.Getpid(), busy.Owner.PID)
+	assert.Equal(t, "deploy", busy.Owner.Command)
+
+	unlock()
+	unlock, err = LockDeployment(context.Background(), "test", "remove")
+	assert.NoError(t, err)
+	unlock()
+	_, err = os.Stat(lockFile("test"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestLockDeploymentStale(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	hostname, _ := os.Hostname()
+	// pid beyond the default pid_max, so it cannot exist
+	data, _ := json.Marshal(LockOwner{PID: 1 << 30, Hostname: hostname, Command: "deploy"})
+	assert.NoError(t, os.MkdirAll(deploymentsDir(), 0755))
+	assert.NoError(t, os.WriteFile(lockFile("test"), data, 0644))
+
+	unlock, err := LockDeployment(context.Background(), "test", "deploy")
+	assert.NoError(t, err)
+	defer unlock()
+	owner, err := readLockOwner(lockFile("test"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.Getpid(), owner.PID)
+}
+
+func TestLockDeploymentWait(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	WaitLock = true
+	defer func() { WaitLock = false }()
+	unlock, err := LockDeployment(context.Background(), "test", "deploy")
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = LockDeployment(ctx, "test", "test")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	time.AfterFunc(100*time.Millisecond, unlock)
+	unlock, err = LockDeployment(context.Background(), "test", "test")
+	assert.NoError(t, err)
+	unlock()
+}
@@ -0,0 +1,272 @@
+package deploy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"soil/util"
+)
+
+// MIMIR_PORT is the port of the mimir service in the tester namespace.
+const MIMIR_PORT = 9009
+
+// MIMIR_PROMETHEUS_PATH is the prefix of the Prometheus API served by mimir.
+const MIMIR_PROMETHEUS_PATH = "/mimir/prometheus"
+
+// Units of metric queries
+const (
+	UnitCores   = "cores"
+	UnitBytes   = "bytes"
+	UnitSeconds = "seconds"
+)
+
+// MetricQuery is a PromQL query summarizing a time window, $window in the
+// query is replaced by the length of the window, e.g. 300s.
+type MetricQuery struct {
+	Name  string `json:"name" yaml:"name"`
+	Query string `json:"query" yaml:"query"`
+	Unit  string `json:"unit,omitempty" yaml:"unit,omitempty"`
+}
+
+func k6Quantile(q float64, metric string) string {
+	return fmt.Sprintf(`histogram_quantile(%g, sum by (test, cluster) (rate(%s[$window])))`, q, metric)
+}
+
+const rancherCpu = `sum by (pod) (node_namespace_pod_container:container_cpu_usage_seconds_total:sum_irate{namespace="cattle-system",container="rancher"})`
+const rancherMemory = `sum by (pod) (node_namespace_pod_container:container_memory_working_set_bytes{namespace="cattle-system",container="rancher"})`
+
+// MetricQueries are key series printed by `so metrics`. Rancher CPU and
+// memory come from container cgroup stats recorded by rancher-monitoring,
+// API latency is the time k6 waited for responses of the servers.
+var MetricQueries = []MetricQuery{
+	{Name: "rancher_cpu_avg", Query: "avg_over_time(" + rancherCpu + "[$window:1m])", Unit: UnitCores},
+	{Name: "rancher_cpu_max", Query: "max_over_time(" + rancherCpu + "[$window:1m])", Unit: UnitCores},
+	{Name: "rancher_memory_max", Query: "max_over_time(" + rancherMemory + "[$window:1m])", Unit: UnitBytes},
+	{Name: "api_latency_p95", Query: k6Quantile(0.95, "k6_http_req_waiting_seconds"), Unit: UnitSeconds},
+	{Name: "http_req_duration_p50", Query: k6Quantile(0.5, "k6_http_req_duration_seconds"), Unit: UnitSeconds},
+	{Name: "http_req_duration_p95", Query: k6Quantile(0.95, "k6_http_req_duration_seconds"), Unit: UnitSeconds},
+	{Name: "http_req_duration_p99", Query: k6Quantile(0.99, "k6_http_req_duration_seconds"), Unit: UnitSeconds},
+}
+
+// MetricsOptions select the time window and the way to reach mimir.
+type MetricsOptions struct {
+	// Run is the test run of the window, the latest one if empty
+	Run string
+	// Since selects the window ending now instead of a test run
+	Since time.Duration
+	// PortForward reaches mimir by kubectl port-forward instead of the tester ingress
+	PortForward bool
+	// Queries are run in addition to MetricQueries
+	Queries map[string]string
+}
+
+// MetricSample is a series of a query result.
+type MetricSample struct {
+	Name   string            `json:"name" yaml:"name"`
+	Labels map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+	Value  float64           `json:"value" yaml:"value"`
+	Unit   string            `json:"unit,omitempty" yaml:"unit,omitempty"`
+}
+
+// MetricsReport are results of metric queries for a time window.
+type MetricsReport struct {
+	Deployment string         `json:"deployment" yaml:"deployment"`
+	Run        string         `json:"run,omitempty" yaml:"run,omitempty"`
+	From       time.Time      `json:"from" yaml:"from"`
+	To         time.Time      `json:"to" yaml:"to"`
+	Samples    []MetricSample `json:"samples" yaml:"samples"`
+}
+
+// promResponse is a response of the Prometheus instant query API.
+type promResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
+	Data   struct {
+		Result []struct {
+			Metric map[string]string `json:"metric"`
+			Value  []any             `json:"value"`
+		} `json:"result"`
+	} `json:"data"`
+}
+
+// window returns the length of the time window as PromQL duration, at least 1m.
+func window(from time.Time, to time.Time) string {
+	seconds := int(math.Ceil(to.Sub(from).Seconds()))
+	if seconds < 60 {
+		seconds = 60
+	}
+	return strconv.Itoa(seconds) + "s"
+}
+
+// metricsWindow returns the time window of the options.
+func metricsWindow(name string, o MetricsOptions) (*MetricsReport, error) {
+	if o.Since > 0 {
+		to := time.Now().UTC()
+		return &MetricsReport{Deployment: name, From: to.Add(-o.Since), To: to}, nil
+	}
+	id := o.Run
+	if id == "" {
+		id = LATEST_RUN
+	}
+	run, err := LoadRun(name, id)
+	if err != nil {
+		return nil, err
+	}
+	to := run.FinishedAt
+	if to.IsZero() {
+		to = time.Now().UTC()
+	}
+	return &MetricsReport{Deployment: name, Run: run.ID, From: run.StartedAt, To: to}, nil
+}
+
+/**
+ * Metrics: query mimir of the tester cluster for key series of a time window.
+ *
+ * The window is the one of a test run, or the last o.Since. Mimir is reached
+ * by the tester ingress, or by kubectl port-forward if the tester cluster
+ * has no local http port or o.PortForward is set.
+ */
+func (d ScalabilityDeployment) Metrics(ctx context.Context, o MetricsOptions) (*MetricsReport, error) {
+	report, err := metricsWindow(d.Name, o)
+	if err != nil {
+		return nil, err
+	}
+	queries := append([]MetricQuery{}, MetricQueries...)
+	names := []string{}
+	for name := range o.Queries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		queries = append(queries, MetricQuery{Name: name, Query: o.Queries[name]})
+	}
+
+	outputs, err := d.getOutputs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tester := outputs.Tester()
+	url := fmt.Sprintf("http://%s:%d%s", tester.LocalName, tester.LocalHttpPort, MIMIR_PROMETHEUS_PATH)
+	if o.PortForward || tester.LocalHttpPort == 0 {
+		port, stop, err := d.run().PortForward(ctx, tester.Access(), "tester", "svc/mimir", MIMIR_PORT)
+		if err != nil {
+			return nil, stepError("kubectl port-forward svc/mimir", err)
+		}
+		defer stop()
+		url = fmt.Sprintf("http://127.0.0.1:%d%s", port, MIMIR_PROMETHEUS_PATH)
+	}
+
+	w := window(report.From, report.To)
+	report.Samples = []MetricSample{}
+	for _, q := range queries {
+		samples, err := d.promQuery(ctx, url, q, strings.ReplaceAll(q.Query, "$window", w), report.To)
+		if err != nil {
+			return nil, err
+		}
+		report.Samples = append(report.Samples, samples...)
+	}
+	return report, nil
+}
+
+// promQuery runs the PromQL instant query at the time.
+func (d ScalabilityDeployment) promQuery(ctx context.Context, url string, q MetricQuery, query string, at time.Time) ([]MetricSample, error) {
+	cmd := strings.Join([]string{
+		"curl", "-sS", "--fail-with-body", "--retry", "10", "--retry-connrefused", "--retry-delay", "1",
+		"-G", url + "/api/v1/query",
+		"--data-urlencode", util.ShellQuote("query=" + query),
+		"--data-urlencode", "time=" + strconv.FormatInt(at.Unix(), 10),
+	}, " ")
+	log.Printf("Running command: %s", cmd)
+	output, err := d.run().ShellQuietOutput(ctx, cmd)
+	if err != nil {
+		return nil, stepError("query "+q.Name, err)
+	}
+	var r promResponse
+	if err := json.Unmarshal([]byte(output), &r); err != nil {
+		return nil, fmt.Errorf("Invalid response of query %s: %w", q.Name, err)
+	}
+	if r.Status != "success" {
+		return nil, fmt.Errorf("Query %s failed: %s", q.Name, r.Error)
+	}
+	samples := []MetricSample{}
+	for _, s := range r.Data.Result {
+		if len(s.Value) != 2 {
+			continue
+		}
+		v, err := strconv.ParseFloat(fmt.Sprint(s.Value[1]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid value of query %s: %w", q.Name, err)
+		}
+		if math.IsNaN(v) {
+			// no data in the window, e.g. a quantile of no requests
+			continue
+		}
+		labels := map[string]string{}
+		for k, l := range s.Metric {
+			if k != "__name__" {
+				labels[k] = l
+			}
+		}
+		samples = append(samples, MetricSample{Name: q.Name, Labels: labels, Value: v, Unit: q.Unit})
+	}
+	sort.SliceStable(samples, func(i, j int) bool {
+		return formatLabels(samples[i].Labels) < formatLabels(samples[j].Labels)
+	})
+	return samples, nil
+}
+
+func formatLabels(labels map[string]string) string {
+	keys := []string{}
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := []string{}
+	for _, k := range keys {
+		pairs = append(pairs, k+"="+labels[k])
+	}
+	return strings.Join(pairs, ",")
+}
+
+// FormatValue formats the value in the unit for humans.
+func (s MetricSample) FormatValue() string {
+	switch s.Unit {
+	case UnitSeconds:
+		return formatMs(s.Value * 1000)
+	case UnitBytes:
+		return fmt.Sprintf("%.1fMiB", s.Value/(1<<20))
+	case UnitCores:
+		return fmt.Sprintf("%.3f", s.Value)
+	}
+	return strconv.FormatFloat(s.Value, 'g', 6, 64)
+}
+
+// PrintTable writes a table of the samples.
+func (r *MetricsReport) PrintTable(out io.Writer) error {
+	fmt.Fprintf(out, "Metrics of %s from %s to %s", r.Deployment,
+		r.From.Local().Format(time.RFC3339), r.To.Local().Format(time.RFC3339))
+	if r.Run != "" {
+		fmt.Fprintf(out, " (test run %s)", r.Run)
+	}
+	fmt.Fprintln(out)
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "METRIC\tSERIES\tVALUE")
+	for _, s := range r.Samples {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", s.Name, dashIfEmpty(formatLabels(s.Labels)), s.FormatValue())
+	}
+	return w.Flush()
+}
+
+func (d CommonDeployment) Metrics(ctx context.Context, o MetricsOptions) (*MetricsReport, error) {
+	return nil, fmt.Errorf("Metrics are not implemented for deployment: %s", reflect.TypeOf(d))
+}
@@ -0,0 +1,63 @@
+package deploy
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testPromResponse = `{"status": "success", "data": {"resultType": "vector", "result": [
+  {"metric": {"pod": "rancher-1"}, "value": [1700000000, "0.25"]},
+  {"metric": {"pod": "rancher-0"}, "value": [1700000000, "1.5"]},
+  {"metric": {"pod": "rancher-2"}, "value": [1700000000, "NaN"]}
+]}}`
+
+func TestWindow(t *testing.T) {
+	from := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	assert.Equal(t, "60s", window(from, from.Add(10*time.Second)))
+	assert.Equal(t, "301s", window(from, from.Add(300*time.Second+time.Millisecond)))
+}
+
+func TestScalabilityDeploymentMetrics(t *testing.T) {
+	d, _ := newTestDeployment(t)
+	_, err := d.Metrics(context.Background(), MetricsOptions{})
+	assert.ErrorContains(t, err, "No test runs")
+
+	assert.NoError(t, d.Test(context.Background()))
+	f := newTestExecutor().On(`^curl .*api/v1/query`, testPromResponse, 0)
+	d.Executor = f
+	report, err := d.Metrics(context.Background(), MetricsOptions{Queries: map[string]string{"cgroups": "sum(cgroups_cpu)"}})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, report.Run)
+	queries := f.Matching(`^curl `)
+	assert.Len(t, queries, len(MetricQueries)+1)
+	assert.Contains(t, queries[0], "http://tester.local.gd:8080/mimir/prometheus/api/v1/query")
+	assert.Contains(t, queries[0], "[60s:1m]")
+	assert.Contains(t, queries[len(queries)-1], "'query=sum(cgroups_cpu)'")
+	assert.Len(t, report.Samples, 2*(len(MetricQueries)+1))
+	assert.Equal(t, "rancher_cpu_avg", report.Samples[0].Name)
+	assert.Equal(t, map[string]string{"pod": "rancher-0"}, report.Samples[0].Labels)
+	assert.Equal(t, 1.5, report.Samples[0].Value)
+	assert.Equal(t, "cgroups", report.Samples[len(report.Samples)-1].Name)
+
+	var out strings.Builder
+	assert.NoError(t, report.PrintTable(&out))
+	assert.Contains(t, out.String(), "test run "+report.Run)
+	assert.Contains(t, out.String(), "http_req_duration_p95  pod=rancher-0  1500.00ms")
+
+	f = newTestExecutor().On(`^curl `, testPromResponse, 0)
+	d.Executor = f
+	report, err = d.Metrics(context.Background(), MetricsOptions{Since: time.Hour, PortForward: true})
+	assert.NoError(t, err)
+	assert.Empty(t, report.Run)
+	assert.Len(t, f.Matching(`^kubectl port-forward --namespace=tester svc/mimir \d+:9009`), 1)
+	assert.Contains(t, f.Matching(`^curl `)[0], "http://127.0.0.1:")
+	assert.Contains(t, f.Matching(`^curl `)[0], "[3600s:1m]")
+
+	d.Executor = newTestExecutor().On(`^curl `, `{"status": "error", "error": "bad query"}`, 0)
+	_, err = d.Metrics(context.Background(), MetricsOptions{Since: time.Hour})
+	assert.ErrorContains(t, err, "bad query")
+}
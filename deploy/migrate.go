@@ -0,0 +1,228 @@
+package deploy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"soil/util"
+)
+
+// STATUS_VERSION is the schema version of status files written by soil.
+// Status files without version field are considered version 1.
+const STATUS_VERSION = 3
+
+// ErrStatusVersion is returned for status files written by a newer soil.
+var ErrStatusVersion = errors.New("unsupported status version")
+
+// Migration upgrades a decoded status file to the Version.
+type Migration struct {
+	Version     int
+	Description string
+	Migrate     func(status map[string]any) error
+}
+
+// Migrations is the registry of status migrations ordered by version,
+// a migration to version N is applied to status files of version N-1.
+var Migrations = []Migration{
+	{
+		Version:     2,
+		Description: "use stable deployment type names and add schema version",
+		Migrate:     migrateTypeNames,
+	},
+	{
+		Version:     3,
+		Description: "record versions of installed charts",
+		Migrate:     migrateChartVersions,
+	},
+}
+
+var legacyTypeNames = map[string]string{
+	"deploy.ScalabilityDeployment": "scalability",
+	"deploy.CommonDeployment":      "common",
+}
+
+func migrateTypeNames(status map[string]any) error {
+	t, _ := status["type"].(string)
+	if name, found := legacyTypeNames[t]; found {
+		status["type"] = name
+	}
+	if _, ok := status["extra"].(map[string]any); !ok {
+		status["extra"] = map[string]any{}
+	}
+	return nil
+}
+
+// legacyCharts are charts installed before versions were recorded in status.
+var legacyCharts = map[string]map[string]any{
+	"rancher":      {"version": "2.7.6"},
+	"cert-manager": {"version": "1.8.0"},
+	"grafana":      {"version": "6.56.5"},
+	"rancher-monitoring": {
+		"version": "102.0.0+up40.1.2",
+		"url":     "https://github.com/rancher/charts/raw/release-v2.7/assets/rancher-monitoring/rancher-monitoring-102.0.0%2Bup40.1.2.tgz",
+	},
+	"rancher-monitoring-crd": {
+		"version": "102.0.0+up40.1.2",
+		"url":     "https://github.com/rancher/charts/raw/release-v2.7/assets/rancher-monitoring-crd/rancher-monitoring-crd-102.0.0%2Bup40.1.2.tgz",
+	},
+}
+
+func migrateChartVersions(status map[string]any) error {
+	if status["type"] != "scalability" {
+		return nil
+	}
+	d, ok := status["deployment"].(map[string]any)
+	if !ok {
+		return fmt.Errorf("deployment is missing")
+	}
+	charts, ok := d["charts"].(map[string]any)
+	if !ok {
+		charts = map[string]any{}
+	}
+	for name, legacy := range legacyCharts {
+		chart, ok := charts[name].(map[string]any)
+		if !ok {
+			chart = map[string]any{}
+		}
+		if v, _ := chart["version"].(string); v != "" {
+			continue
+		}
+		for k, v := range legacy {
+			chart[k] = v
+		}
+		charts[name] = chart
+	}
+	d["charts"] = charts
+	return nil
+}
+
+func statusVersion(status map[string]any) (int, error) {
+	v, found := status["version"]
+	if !found || v == nil {
+		return 1, nil
+	}
+	f, ok := v.(float64)
+	if !ok || f < 1 || f != float64(int(f)) {
+		return 0, fmt.Errorf("invalid status version: %v", v)
+	}
+	return int(f), nil
+}
+
+// MigrateStatus upgrades status file data to STATUS_VERSION,
+// it returns migrated data and the version of the original data.
+func MigrateStatus(data []byte) ([]byte, int, error) {
+	m := map[string]any{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, 0, err
+	}
+	version, err := statusVersion(m)
+	if err != nil {
+		return nil, 0, err
+	}
+	if version > STATUS_VERSION {
+		return nil, version, fmt.Errorf("%w: %d, this soil supports up to %d, please upgrade soil",
+			ErrStatusVersion, version, STATUS_VERSION)
+	}
+	if version == STATUS_VERSION {
+		return data, version, nil
+	}
+	for _, mg := range Migrations {
+		if mg.Version <= version {
+			continue
+		}
+		log.Printf("Migrating status to version %d: %s", mg.Version, mg.Description)
+		if err := mg.Migrate(m); err != nil {
+			return nil, version, fmt.Errorf("migration to version %d failed: %w", mg.Version, err)
+		}
+		m["version"] = mg.Version
+	}
+	migrated, err := json.Marshal(m)
+	if err != nil {
+		return nil, version, err
+	}
+	return migrated, version, nil
+}
+
+// readStatusFile returns status data of the deployment migrated in memory,
+// together with the original version. The file is not changed, it may be
+// saved by another process holding the deployment lock.
+func readStatusFile(name string) ([]byte, int, error) {
+	data, err := os.ReadFile(statusFile(name))
+	if os.IsNotExist(err) {
+		return nil, 0, fmt.Errorf("%w: '%s'", ErrNotFound, name)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	migrated, version, err := MigrateStatus(data)
+	if err != nil {
+		return nil, version, fmt.Errorf("Invalid status of deployment '%s': %w", name, err)
+	}
+	return migrated, version, nil
+}
+
+// backupStatus keeps the status file of an older version as status.vN,
+// before it is overwritten by the current version.
+func backupStatus(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	m := map[string]any{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil
+	}
+	version, err := statusVersion(m)
+	if err != nil || version >= STATUS_VERSION {
+		return nil
+	}
+	backup := fmt.Sprintf("%s.v%d", path, version)
+	if _, err := os.Stat(backup); err == nil {
+		return nil
+	}
+	log.Printf("Saving status version %d to '%s'", version, backup)
+	return util.WriteFileAtomic(backup, data, 0644)
+}
+
+/**
+ * MigrateDeployment: upgrade status file of the deployment to STATUS_VERSION
+ * in place, keeping a copy of the original file.
+ *
+ * The caller must hold the deployment lock, see LockDeployment. Returns the
+ * version the status had before.
+ */
+func MigrateDeployment(name string) (int, error) {
+	migrated, version, err := readStatusFile(name)
+	if err != nil || version == STATUS_VERSION {
+		return version, err
+	}
+	path := statusFile(name)
+	if util.DryRun {
+		log.Printf("Dry run, skipping migration of '%s'", path)
+		return version, nil
+	}
+	if err := backupStatus(path); err != nil {
+		return version, err
+	}
+	return version, util.WriteFileAtomic(path, migrated, 0644)
+}
+
+// DeploymentNames returns names of all directories in the deployments dir.
+func DeploymentNames() ([]string, error) {
+	names := []string{}
+	items, err := os.ReadDir(deploymentsDir())
+	if os.IsNotExist(err) {
+		return names, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range items {
+		if f.IsDir() {
+			names = append(names, f.Name())
+		}
+	}
+	return names, nil
+}
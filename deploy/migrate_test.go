@@ -0,0 +1,77 @@
+package deploy
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testLegacyStatus = `{"deployment": {"deployment_name": "legacy", "repo_url": "https://github.com/moio/scalability-tests",
+	"branch_name": "main", "rancher_replicas": 1, "kind": "k3d"},
+	"type": "deploy.ScalabilityDeployment", "name": "legacy", "extra": null}`
+
+func writeTestStatus(t *testing.T, name string, data string) {
+	t.Setenv("HOME", t.TempDir())
+	assert.NoError(t, os.MkdirAll(workdir(name), 0755))
+	assert.NoError(t, os.WriteFile(statusFile(name), []byte(data), 0644))
+}
+
+func TestLookupDeploymentMigratesLegacyStatus(t *testing.T) {
+	writeTestStatus(t, "legacy", testLegacyStatus)
+
+	d, err := LookupDeployment("legacy")
+	assert.NoError(t, err)
+	assert.Equal(t, "k3d", d.(*ScalabilityDeployment).Kind)
+	assert.Equal(t, 1, d.(*ScalabilityDeployment).RancherReplicas)
+	assert.Equal(t, "2.7.6", d.(*ScalabilityDeployment).Charts["rancher"].Version)
+	assert.Equal(t, legacyCharts["rancher-monitoring"]["url"], d.(*ScalabilityDeployment).chartURL("rancher-monitoring"))
+
+	// lookup does not lock, the status is migrated in memory only
+	data, err := os.ReadFile(statusFile("legacy"))
+	assert.NoError(t, err)
+	assert.Equal(t, testLegacyStatus, string(data))
+	assert.NoFileExists(t, statusFile("legacy")+".v1")
+
+	// saved by commands holding the lock
+	assert.NoError(t, d.saveStatus())
+	data, err = os.ReadFile(statusFile("legacy"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), fmt.Sprintf(`"version":%d`, STATUS_VERSION))
+	assert.Contains(t, string(data), `"type":"scalability"`)
+	backup, err := os.ReadFile(statusFile("legacy") + ".v1")
+	assert.NoError(t, err)
+	assert.Equal(t, testLegacyStatus, string(backup))
+}
+
+func TestMigrateDeploymentUpToDate(t *testing.T) {
+	writeTestStatus(t, "legacy", testLegacyStatus)
+
+	version, err := MigrateDeployment("legacy")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, version)
+	backup, err := os.ReadFile(statusFile("legacy") + ".v1")
+	assert.NoError(t, err)
+	assert.Equal(t, testLegacyStatus, string(backup))
+	version, err = MigrateDeployment("legacy")
+	assert.NoError(t, err)
+	assert.Equal(t, STATUS_VERSION, version)
+}
+
+func TestMigrateStatusNewerVersion(t *testing.T) {
+	_, version, err := MigrateStatus([]byte(`{"version": 99, "type": "scalability"}`))
+	assert.ErrorIs(t, err, ErrStatusVersion)
+	assert.Equal(t, 99, version)
+}
+
+func TestSaveStatusVersion(t *testing.T) {
+	d, _ := newTestDeployment(t)
+	d.saveStatus()
+
+	data, err := os.ReadFile(d.StatusFile())
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), fmt.Sprintf(`"version":%d`, STATUS_VERSION))
+	_, err = os.Stat(d.StatusFile() + ".v1")
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,134 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var Resume bool
+var FromPhase string
+var OnlyPhase string
+
+// PhaseTimeout limits duration of every phase, no limit if zero.
+var PhaseTimeout time.Duration
+
+// WaitTimeout limits waiting for rancher and clusters to become ready.
+var WaitTimeout = time.Hour
+
+const (
+	StateDeploying   = "deploying"
+	StateDeployed    = "deployed"
+	StateInterrupted = "interrupted"
+	StateFailed      = "failed"
+)
+
+const (
+	PhaseTerraform            = "terraform"
+	PhaseTester               = "tester"
+	PhaseCertManager          = "cert-manager"
+	PhaseRancher              = "rancher"
+	PhaseMonitoring           = "monitoring"
+	PhaseImport               = "import"
+	PhaseDownstreamMonitoring = "downstream-monitoring"
+)
+
+type phase struct {
+	Name        string
+	Description string
+	Run         func(ScalabilityDeployment, context.Context) error
+}
+
+// phases lists deployment steps in the order they are executed by Run.
+var phases = []phase{
+	{PhaseTerraform, "create clusters by terraform or the kind provider", ScalabilityDeployment.createClusters},
+	{PhaseTester, "install tester cluster charts", ScalabilityDeployment.installTester},
+	{PhaseCertManager, "install cert-manager to upstream cluster", ScalabilityDeployment.installCertManager},
+	{PhaseRancher, "install rancher to upstream cluster", ScalabilityDeployment.installRancher},
+	{PhaseMonitoring, "install monitoring to upstream cluster", ScalabilityDeployment.installUpstreamMonitoring},
+	{PhaseImport, "import downstream clusters", ScalabilityDeployment.importDownstreamClusters},
+	{PhaseDownstreamMonitoring, "install monitoring to downstream clusters", ScalabilityDeployment.installDownstreamMonitoring},
+}
+
+func PhaseNames() []string {
+	names := []string{}
+	for _, p := range phases {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+func lookupPhase(name string) *phase {
+	for i := range phases {
+		if phases[i].Name == name {
+			return &phases[i]
+		}
+	}
+	return nil
+}
+
+func checkPhase(name string) error {
+	if lookupPhase(name) == nil {
+		return fmt.Errorf("Unknown phase '%s', expected one of: %s",
+			name, strings.Join(PhaseNames(), ", "))
+	}
+	return nil
+}
+
+func completePhase(completed []string, name string) []string {
+	for _, c := range completed {
+		if c == name {
+			return completed
+		}
+	}
+	return append(completed, name)
+}
+
+/**
+ * SelectPhases returns names of the phases to be executed.
+ *
+ * With only set, just that phase is returned; with from set, the phase and
+ * all the following ones; with resume, the phases not yet completed;
+ * otherwise all the phases.
+ */
+func SelectPhases(completed []string, resume bool, from string, only string) ([]string, error) {
+	names := PhaseNames()
+	if only != "" {
+		if err := checkPhase(only); err != nil {
+			return nil, err
+		}
+		return []string{only}, nil
+	}
+	if from != "" {
+		if err := checkPhase(from); err != nil {
+			return nil, err
+		}
+		for i, name := range names {
+			if name == from {
+				return names[i:], nil
+			}
+		}
+	}
+	if resume {
+		done := map[string]bool{}
+		for _, c := range completed {
+			done[c] = true
+		}
+		pending := []string{}
+		for _, name := range names {
+			if !done[name] {
+				pending = append(pending, name)
+			}
+		}
+		return pending, nil
+	}
+	return names, nil
+}
+
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
@@ -0,0 +1,39 @@
+package deploy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelectPhasesAll(t *testing.T) {
+	names, err := SelectPhases([]string{PhaseTerraform}, false, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, PhaseNames(), names)
+}
+
+func TestSelectPhasesResume(t *testing.T) {
+	names, err := SelectPhases([]string{PhaseTerraform, PhaseTester, PhaseCertManager, PhaseRancher, PhaseMonitoring},
+		true, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{PhaseImport, PhaseDownstreamMonitoring}, names)
+}
+
+func TestSelectPhasesFrom(t *testing.T) {
+	names, err := SelectPhases(nil, false, PhaseImport, "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{PhaseImport, PhaseDownstreamMonitoring}, names)
+}
+
+func TestSelectPhasesOnly(t *testing.T) {
+	names, err := SelectPhases(nil, false, "", PhaseRancher)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{PhaseRancher}, names)
+}
+
+func TestSelectPhasesUnknown(t *testing.T) {
+	_, err := SelectPhases(nil, false, "", "nothing")
+	assert.Error(t, err)
+	_, err = SelectPhases(nil, false, "nothing", "")
+	assert.Error(t, err)
+}
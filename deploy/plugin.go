@@ -0,0 +1,166 @@
+package deploy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"soil/util"
+)
+
+// KIND_PLUGIN_PREFIX prefixes names of executables providing external kinds.
+const KIND_PLUGIN_PREFIX = "so-kind-"
+
+// KIND_PLUGIN_REQUEST is the file of the last request sent to the kind plugin, in the workdir.
+const KIND_PLUGIN_REQUEST = "kind-request.json"
+
+// Commands of the kind plugin protocol
+const (
+	PluginRequirements = "requirements"
+	PluginMake         = "make"
+	PluginOutputs      = "outputs"
+	PluginRemove       = "remove"
+)
+
+// PluginRequest is written to stdin of `so-kind-NAME COMMAND`.
+type PluginRequest struct {
+	Command    string         `json:"command"`
+	Deployment string         `json:"deployment"`
+	Workdir    string         `json:"workdir"`
+	Vars       map[string]any `json:"vars,omitempty"`
+}
+
+// PluginResponse is printed by the plugin to stdout, logs go to stderr.
+type PluginResponse struct {
+	// Error is reported by the plugin exiting with non-zero code
+	Error string `json:"error,omitempty"`
+	// Missing are requirements which are not met
+	Missing []string `json:"missing,omitempty"`
+	// Clusters are outputs of the deployment by cluster name as in the value of the
+	// terraform clusters output, see Cluster, tester and upstream are required
+	Clusters map[string]any `json:"clusters,omitempty"`
+}
+
+// pluginProvider creates clusters by the kind plugin executable.
+type pluginProvider struct {
+	Path string
+}
+
+// lookupKindPlugin returns the kind provided by so-kind-NAME found on PATH.
+func lookupKindPlugin(name string) (Kind, bool) {
+	if name == "" || strings.ContainsRune(name, filepath.Separator) {
+		return Kind{}, false
+	}
+	path, err := exec.LookPath(KIND_PLUGIN_PREFIX + name)
+	if err != nil {
+		return Kind{}, false
+	}
+	return Kind{
+		Name:        name,
+		Description: "external kind " + path,
+		// clusters are created by the plugin, rancher is installed from charts of the repo
+		Tools:    []Tool{ToolGit, ToolKubectl, ToolHelm},
+		Provider: pluginProvider{Path: path},
+		Plugin:   true,
+	}, true
+}
+
+// kindPluginNames returns names of kinds provided by executables on PATH.
+func kindPluginNames() []string {
+	names := []string{}
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		matches, _ := filepath.Glob(filepath.Join(dir, KIND_PLUGIN_PREFIX+"*"))
+		for _, path := range matches {
+			name := strings.TrimPrefix(filepath.Base(path), KIND_PLUGIN_PREFIX)
+			if _, ok := lookupKindPlugin(name); ok && !contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+/**
+ * call: run the plugin command with the request of the deployment on stdin.
+ *
+ * The request is kept in the workdir, so that it can be inspected when
+ * developing the plugin.
+ */
+func (p pluginProvider) call(ctx context.Context, d ScalabilityDeployment, command string) (*PluginResponse, error) {
+	data, err := json.MarshalIndent(PluginRequest{
+		Command:    command,
+		Deployment: d.Name,
+		Workdir:    d.Workdir(),
+		Vars:       d.TerraformVars,
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(d.Workdir(), KIND_PLUGIN_REQUEST)
+	if util.DryRun {
+		fmt.Printf("cat > %s <<EOF\n%s\nEOF\n", path, data)
+	} else {
+		// requirements are checked before the workdir is made
+		if err := os.MkdirAll(d.Workdir(), 0755); err != nil {
+			return nil, err
+		}
+		if err := util.WriteFileAtomic(path, data, 0600); err != nil {
+			return nil, err
+		}
+	}
+	cmd := util.ShellQuote(p.Path) + " " + command + " < " + util.ShellQuote(path)
+	log.Printf("Running command: %s", cmd)
+	output, err := d.run().ShellQuietOutput(ctx, cmd)
+	response := &PluginResponse{}
+	if strings.TrimSpace(output) != "" {
+		if jerr := json.Unmarshal([]byte(output), response); jerr != nil && err == nil {
+			return nil, fmt.Errorf("Invalid response of %s %s: %w", filepath.Base(p.Path), command, jerr)
+		}
+	}
+	if err != nil {
+		if response.Error != "" {
+			err = fmt.Errorf("%s: %w", response.Error, err)
+		}
+		return nil, stepError(filepath.Base(p.Path)+" "+command, err)
+	}
+	return response, nil
+}
+
+func (p pluginProvider) Requirements(ctx context.Context, d ScalabilityDeployment) []string {
+	if util.DryRun {
+		return nil
+	}
+	r, err := p.call(ctx, d, PluginRequirements)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	return r.Missing
+}
+
+func (p pluginProvider) Create(ctx context.Context, d ScalabilityDeployment) error {
+	_, err := p.call(ctx, d, PluginMake)
+	return err
+}
+
+func (p pluginProvider) Outputs(ctx context.Context, d ScalabilityDeployment) (*TerraformOutputs, error) {
+	r, err := p.call(ctx, d, PluginOutputs)
+	if err != nil {
+		return nil, err
+	}
+	// validate outputs the same way as terraform ones
+	data, err := json.Marshal(map[string]any{"clusters": map[string]any{"value": r.Clusters}})
+	if err != nil {
+		return nil, err
+	}
+	return ParseTerraformOutputs(data)
+}
+
+func (p pluginProvider) Destroy(ctx context.Context, d ScalabilityDeployment) error {
+	_, err := p.call(ctx, d, PluginRemove)
+	return err
+}
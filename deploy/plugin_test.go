@@ -0,0 +1,101 @@
+package deploy
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// installKindPlugin puts an executable so-kind-NAME on PATH.
+func installKindPlugin(t *testing.T, name string) string {
+	dir := t.TempDir()
+	path := filepath.Join(dir, KIND_PLUGIN_PREFIX+name)
+	assert.NoError(t, os.WriteFile(path, []byte("#!/bin/sh\n"), 0755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return path
+}
+
+func TestLookupKindPlugin(t *testing.T) {
+	path := installKindPlugin(t, "lab")
+	assert.Contains(t, KindNames(), "lab")
+	k := testKind(t, "lab")
+	assert.Equal(t, pluginProvider{Path: path}, k.Provider)
+
+	// built-in kinds win over plugins
+	installKindPlugin(t, "k3d")
+	assert.Nil(t, testKind(t, "k3d").Provider)
+	count := 0
+	for _, name := range KindNames() {
+		if name == "k3d" {
+			count++
+		}
+	}
+	assert.Equal(t, 1, count)
+}
+
+func TestScalabilityDeploymentMakePlugin(t *testing.T) {
+	installKindPlugin(t, "lab")
+	d, f := newTestDeployment(t)
+	d.Kind = "lab"
+	d.TerraformVars = map[string]any{"hosts": 3}
+	var clusters map[string]map[string]any
+	assert.NoError(t, json.Unmarshal([]byte(testTerraformOutput), &clusters))
+	outputs, _ := json.Marshal(map[string]any{"clusters": clusters["clusters"]["value"]})
+	f.On(`so-kind-lab' requirements`, `{"missing": ["vpn is not connected"]}`, 0).
+		On(`so-kind-lab' outputs`, string(outputs), 0)
+
+	assert.False(t, d.CheckRequirements(context.Background()))
+	_, err := d.Make(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, f.Matching(`^terraform`), 0)
+	assert.Len(t, f.Matching(`so-kind-lab' make < '.*/kind-request.json'$`), 1)
+	assert.Len(t, f.Matching(`^helm .* rancher https://releases.rancher.com/`), 1)
+	assert.Len(t, f.Matching(`^kubectl apply -f .*/secret_c-m-abcdef.yaml --kubeconfig=/tmp/downstream.yaml`), 1)
+
+	data, err := os.ReadFile(filepath.Join(d.Workdir(), KIND_PLUGIN_REQUEST))
+	assert.NoError(t, err)
+	var request PluginRequest
+	assert.NoError(t, json.Unmarshal(data, &request))
+	assert.Equal(t, PluginRequest{Command: PluginOutputs, Deployment: "test", Workdir: d.Workdir(),
+		Vars: map[string]any{"hosts": 3.0}}, request)
+
+	f.On(`so-kind-lab' remove`, `{"error": "lab is unreachable"}`, 1)
+	assert.ErrorContains(t, d.Remove(context.Background(), false), "so-kind-lab remove")
+	assert.ErrorContains(t, d.Remove(context.Background(), false), "lab is unreachable")
+}
+
+func TestPluginOutputsInvalid(t *testing.T) {
+	installKindPlugin(t, "lab")
+	d, f := newTestDeployment(t)
+	d.Kind = "lab"
+	f.On(`so-kind-lab' outputs`, `{"clusters": {"upstream": {}}}`, 0)
+	_, err := d.getOutputs(context.Background())
+	assert.ErrorContains(t, err, "Invalid terraform output of cluster 'upstream'")
+
+	f = newTestExecutor().On(`so-kind-lab' outputs`, `not json`, 0)
+	d.Executor = f
+	_, err = d.getOutputs(context.Background())
+	assert.ErrorContains(t, err, "Invalid response of so-kind-lab outputs")
+}
+
+func TestPluginKindMissing(t *testing.T) {
+	installKindPlugin(t, "lab")
+	assert.True(t, makeDeployment("test", testKind(t, "lab"), nil).KindPlugin)
+
+	d, f := newTestDeployment(t)
+	d.Kind = "lab"
+	d.KindPlugin = true
+	t.Setenv("PATH", t.TempDir())
+	assert.False(t, d.CheckRequirements(context.Background()))
+	_, err := d.getOutputs(context.Background())
+	assert.EqualError(t, err, "Kind plugin so-kind-lab not found on PATH")
+
+	// the workdir is kept even if forced, clusters of the plugin still exist
+	assert.ErrorContains(t, d.Remove(context.Background(), true), "so-kind-lab not found")
+	assert.DirExists(t, d.Workdir())
+	assert.Len(t, f.Matching(`^terraform`), 0)
+}
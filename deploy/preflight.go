@@ -0,0 +1,209 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"soil/util"
+)
+
+// Minimal resources of inventory hosts checked before terraform is applied,
+// MemTotal of a 4GiB host is below 4096MiB as the kernel reserves some memory.
+const (
+	PREFLIGHT_MIN_CPUS       = 2
+	PREFLIGHT_MIN_MEMORY_MIB = 3584
+	PREFLIGHT_MIN_DISK_GIB   = 20
+)
+
+// PREFLIGHT_PORTS are used by k3s and the ingress controller, they must be free.
+var PREFLIGHT_PORTS = []int{80, 443, 6443, 10250}
+
+// PreflightOS are IDs of /etc/os-release supported by the ssh kind.
+var PreflightOS = []string{"ubuntu", "debian", "sles", "opensuse-leap", "opensuse-tumbleweed",
+	"rhel", "rocky", "almalinux", "centos", "fedora"}
+
+// preflightScript prints facts of the host as key=value lines.
+const preflightScript = `. /etc/os-release 2>/dev/null; echo "os=$ID $VERSION_ID"
+echo "cpus=$(nproc)"
+echo "memory_kb=$(awk '/^MemTotal:/ {print $2}' /proc/meminfo)"
+echo "disk_kb=$(df -Pk / | awk 'NR==2 {print $4}')"
+`
+
+// preflightPortsScript prints ports of the list which are in use.
+const preflightPortsScript = `listening=$( (ss -Htln || netstat -tln) 2>/dev/null | awk '{print $4}')
+for port in %s; do echo "$listening" | grep -q ":$port\$" && echo "busy_port=$port"; done
+`
+
+// HostCheck is the result of preflight checks of a host.
+type HostCheck struct {
+	Host      InventoryHost
+	OS        string
+	Cpus      int
+	MemoryMiB int
+	DiskGiB   int
+	BusyPorts []int
+	// Problems of the host, empty if all checks passed
+	Problems []string
+}
+
+// PreflightError reports hosts failing preflight checks.
+type PreflightError struct {
+	Failed []HostCheck
+}
+
+func (e *PreflightError) Error() string {
+	lines := []string{}
+	for _, c := range e.Failed {
+		lines = append(lines, fmt.Sprintf("%s (%s@%s): %s", c.Host.Name, c.Host.User, c.Host.Address,
+			strings.Join(c.Problems, ", ")))
+	}
+	return fmt.Sprintf("Preflight checks failed on %d host(s):\n  - %s", len(e.Failed), strings.Join(lines, "\n  - "))
+}
+
+// sshCommand returns the ssh command running the remote command on the host.
+func sshCommand(h InventoryHost, command string) string {
+	args := []string{"ssh", "-o", "BatchMode=yes", "-o", "ConnectTimeout=10",
+		"-o", "StrictHostKeyChecking=accept-new", "-p", strconv.Itoa(h.Port)}
+	if h.Key != "" {
+		args = append(args, "-i", util.ShellQuote(h.Key))
+	}
+	args = append(args, util.ShellQuote(h.User+"@"+h.Address), util.ShellQuote(command))
+	return strings.Join(args, " ")
+}
+
+// checkHost runs preflight checks of the host over ssh, PREFLIGHT_PORTS are
+// checked if checkPorts is set.
+func checkHost(ctx context.Context, r util.Runner, h InventoryHost, checkPorts bool) HostCheck {
+	c := HostCheck{Host: h}
+	script := preflightScript
+	if checkPorts {
+		ports := []string{}
+		for _, p := range PREFLIGHT_PORTS {
+			ports = append(ports, strconv.Itoa(p))
+		}
+		script += fmt.Sprintf(preflightPortsScript, strings.Join(ports, " "))
+	}
+	output, err := r.ShellQuietOutput(ctx, sshCommand(h, script+"true"))
+	if err != nil {
+		c.Problems = append(c.Problems, fmt.Sprintf("unreachable over ssh: %v", err))
+		return c
+	}
+	for _, line := range strings.Split(output, "\n") {
+		k, v, _ := strings.Cut(strings.TrimSpace(line), "=")
+		n, _ := strconv.Atoi(v)
+		switch k {
+		case "os":
+			c.OS = strings.TrimSpace(v)
+		case "cpus":
+			c.Cpus = n
+		case "memory_kb":
+			c.MemoryMiB = n / 1024
+		case "disk_kb":
+			c.DiskGiB = n / (1024 * 1024)
+		case "busy_port":
+			c.BusyPorts = append(c.BusyPorts, n)
+		}
+	}
+	if id, _, _ := strings.Cut(c.OS, " "); !contains(PreflightOS, id) {
+		c.Problems = append(c.Problems, fmt.Sprintf("unsupported OS '%s'", c.OS))
+	}
+	if c.Cpus < PREFLIGHT_MIN_CPUS {
+		c.Problems = append(c.Problems, fmt.Sprintf("%d CPUs < %d", c.Cpus, PREFLIGHT_MIN_CPUS))
+	}
+	if c.MemoryMiB < PREFLIGHT_MIN_MEMORY_MIB {
+		c.Problems = append(c.Problems, fmt.Sprintf("%dMiB memory < %dMiB", c.MemoryMiB, PREFLIGHT_MIN_MEMORY_MIB))
+	}
+	if c.DiskGiB < PREFLIGHT_MIN_DISK_GIB {
+		c.Problems = append(c.Problems, fmt.Sprintf("%dGiB free disk < %dGiB", c.DiskGiB, PREFLIGHT_MIN_DISK_GIB))
+	}
+	for _, p := range c.BusyPorts {
+		c.Problems = append(c.Problems, fmt.Sprintf("port %d is in use", p))
+	}
+	return c
+}
+
+// CheckHosts runs preflight checks of the hosts in parallel, ports of hosts
+// named in skipPorts are not checked.
+func CheckHosts(ctx context.Context, r util.Runner, hosts []InventoryHost, skipPorts map[string]bool) []HostCheck {
+	checks := make([]HostCheck, len(hosts))
+	var wg sync.WaitGroup
+	for i, h := range hosts {
+		wg.Add(1)
+		go func(i int, h InventoryHost) {
+			defer wg.Done()
+			checks[i] = checkHost(ctx, r, h, !skipPorts[h.Name])
+		}(i, h)
+	}
+	wg.Wait()
+	return checks
+}
+
+// PrintHostChecks writes a table of preflight checks.
+func PrintHostChecks(out io.Writer, checks []HostCheck) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "HOST\tADDRESS\tROLE\tOS\tCPUS\tMEMORY\tDISK\tRESULT")
+	for _, c := range checks {
+		result := "ok"
+		if len(c.Problems) > 0 {
+			result = "FAILED: " + strings.Join(c.Problems, ", ")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%dMiB\t%dGiB\t%s\n", c.Host.Name, c.Host.Address, c.Host.Role,
+			dashIfEmpty(c.OS), c.Cpus, c.MemoryMiB, c.DiskGiB, result)
+	}
+	return w.Flush()
+}
+
+// appliedHosts returns names of inventory hosts found in the terraform state,
+// k3s already listens on their ports if the terraform phase is resumed.
+func (d ScalabilityDeployment) appliedHosts() map[string]bool {
+	applied := map[string]bool{}
+	data, err := os.ReadFile(d.getTerraformStatePath())
+	if err != nil {
+		return applied
+	}
+	for _, h := range d.Inventory.Hosts {
+		if strings.Contains(string(data), strconv.Quote(h.Address)) {
+			log.Printf("Host %s is in the terraform state, its ports are not checked", h.Name)
+			applied[h.Name] = true
+		}
+	}
+	return applied
+}
+
+/**
+ * preflight: check hosts of the inventory before terraform is applied.
+ *
+ * Returns PreflightError listing failing hosts, deployments without inventory
+ * are not checked. Ports of hosts terraform was already applied to are
+ * expected to be in use.
+ */
+func preflight(ctx context.Context, d ScalabilityDeployment) error {
+	if d.Inventory == nil || util.DryRun {
+		return nil
+	}
+	checks := CheckHosts(ctx, d.run(), d.Inventory.Hosts, d.appliedHosts())
+	fmt.Println("Preflight checks of inventory hosts:")
+	if err := PrintHostChecks(os.Stdout, checks); err != nil {
+		return err
+	}
+	failed := []HostCheck{}
+	for _, c := range checks {
+		if len(c.Problems) > 0 {
+			failed = append(failed, c)
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if len(failed) > 0 {
+		return &PreflightError{Failed: failed}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// ClusterProvider creates and removes clusters of a kind, see Kind.Provider.
+type ClusterProvider interface {
+	// Requirements reports problems preventing the deployment, e.g. missing tools
+	Requirements(context.Context, ScalabilityDeployment) []string
+	Create(context.Context, ScalabilityDeployment) error
+	Outputs(context.Context, ScalabilityDeployment) (*TerraformOutputs, error)
+	Destroy(context.Context, ScalabilityDeployment) error
+}
+
+// terraformProvider applies terraform configuration of the scalability-tests repo.
+type terraformProvider struct{}
+
+func (terraformProvider) Requirements(ctx context.Context, d ScalabilityDeployment) []string {
+	return nil
+}
+
+func (terraformProvider) Create(ctx context.Context, d ScalabilityDeployment) error {
+	return d.applyTerraform(ctx)
+}
+
+func (terraformProvider) Outputs(ctx context.Context, d ScalabilityDeployment) (*TerraformOutputs, error) {
+	path := d.getTerraformStatePath()
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, fmt.Errorf("Terraform status file does not exist: %s", path)
+	}
+
+	status, err := d.run().ExecQuietUnmarshalJson(ctx, "terraform",
+		"-chdir="+d.getTerraformWorkDir(),
+		"output", "-json",
+		"-state="+d.getTerraformStatePath())
+
+	if err != nil {
+		return nil, stepError("terraform output", err)
+	}
+	return NewTerraformOutputs(status)
+}
+
+func (terraformProvider) Destroy(ctx context.Context, d ScalabilityDeployment) error {
+	tfWorkdir := d.getRepoLocalPath() + "/" + d.TerraformWorkDir
+	tfState := d.getTerraformStatePath()
+	_, err := d.run().Exec(ctx, "terraform", "-chdir="+tfWorkdir, "destroy", "-auto-approve", "-state="+tfState)
+	return stepError("terraform destroy", err)
+}
+
+// provider returns the cluster provider of the deployment kind, terraform by
+// default. Clusters of plugin kinds are never guessed to be terraform ones.
+func (d ScalabilityDeployment) provider() (ClusterProvider, error) {
+	k := d.kind()
+	if k.Provider != nil {
+		return k.Provider, nil
+	}
+	if k.Plugin {
+		return nil, fmt.Errorf("Kind plugin %s%s not found on PATH", KIND_PLUGIN_PREFIX, d.Kind)
+	}
+	return terraformProvider{}, nil
+}
+
+// createClusters creates clusters by the provider and runs hooks of the kind.
+func (d ScalabilityDeployment) createClusters(ctx context.Context) error {
+	for _, hook := range d.kind().PreApply {
+		if err := hook(ctx, d); err != nil {
+			return err
+		}
+	}
+	p, err := d.provider()
+	if err != nil {
+		return err
+	}
+	if err := p.Create(ctx, d); err != nil {
+		return err
+	}
+	for _, hook := range d.kind().PostApply {
+		if err := hook(ctx, d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+package deploy
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"soil/util"
+)
+
+// Report formats of `so test --report FORMAT=PATH`
+const (
+	ReportJUnit    = "junit"
+	ReportMarkdown = "md"
+)
+
+// Reports map report formats to the files written after `so test`.
+var Reports map[string]string
+
+var reportWriters = map[string]func(io.Writer, *TestRun) error{
+	ReportJUnit:    writeJUnit,
+	ReportMarkdown: writeMarkdown,
+}
+
+// ValidateReports checks formats of the reports, so that tests do not run
+// for nothing.
+func ValidateReports(reports map[string]string) error {
+	for format, path := range reports {
+		if _, ok := reportWriters[format]; !ok {
+			return fmt.Errorf("Unknown report format '%s', expected one of: %s, %s", format, ReportJUnit, ReportMarkdown)
+		}
+		if path == "" {
+			return fmt.Errorf("Missing path of the %s report", format)
+		}
+	}
+	return nil
+}
+
+// suffixReports returns reports with the suffix added to file names, e.g.
+// out-before.xml for out.xml.
+func suffixReports(reports map[string]string, suffix string) map[string]string {
+	suffixed := map[string]string{}
+	for format, path := range reports {
+		ext := filepath.Ext(path)
+		suffixed[format] = strings.TrimSuffix(path, ext) + "-" + suffix + ext
+	}
+	return suffixed
+}
+
+// WriteReports writes the run in all report formats.
+func WriteReports(run *TestRun, reports map[string]string) error {
+	formats := []string{}
+	for format := range reports {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	for _, format := range formats {
+		path := reports[format]
+		if util.DryRun {
+			log.Printf("Dry run, skipping writing %s report to: %s", format, path)
+			continue
+		}
+		var b strings.Builder
+		if err := reportWriters[format](&b, run); err != nil {
+			return err
+		}
+		log.Printf("Writing %s report to: %s", format, path)
+		if err := util.WriteFileAtomic(path, []byte(b.String()), 0644); err != nil {
+			return fmt.Errorf("Unable to write %s report: %w", format, err)
+		}
+	}
+	return nil
+}
+
+// failure returns why the test failed, empty if it passed.
+func (r TestResult) failure() string {
+	if failed := r.Failed(); len(failed) > 0 {
+		return "thresholds failed: " + strings.Join(failed, ", ")
+	}
+	return r.Error
+}
+
+// checks returns the passed and failed checks of the test.
+func (r TestResult) checks() (int, int) {
+	if r.Summary == nil {
+		return 0, 0
+	}
+	return r.Summary.Checks()
+}
+
+// thresholdLines describes every threshold of the test as "ok" or "FAILED".
+func (r TestResult) thresholdLines() []string {
+	if r.Summary == nil {
+		return nil
+	}
+	failed := r.Failed()
+	lines := []string{}
+	for _, th := range r.Summary.Thresholds() {
+		if contains(failed, th) {
+			lines = append(lines, "FAILED "+th)
+		} else {
+			lines = append(lines, "ok "+th)
+		}
+	}
+	return lines
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type junitTestCase struct {
+	Name       string          `xml:"name,attr"`
+	Classname  string          `xml:"classname,attr"`
+	Time       string          `xml:"time,attr"`
+	Properties []junitProperty `xml:"properties>property,omitempty"`
+	Failure    *junitFailure   `xml:"failure,omitempty"`
+	SystemOut  string          `xml:"system-out,omitempty"`
+}
+
+type junitTestSuite struct {
+	XMLName    xml.Name        `xml:"testsuite"`
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Time       string          `xml:"time,attr"`
+	Timestamp  string          `xml:"timestamp,attr"`
+	Properties []junitProperty `xml:"properties>property"`
+	TestCases  []junitTestCase `xml:"testcase"`
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// writeJUnit writes a test case per test and cluster of the run.
+func writeJUnit(w io.Writer, run *TestRun) error {
+	suite := junitTestSuite{
+		Name:      run.Suite,
+		Tests:     len(run.Results),
+		Timestamp: run.StartedAt.Format("2006-01-02T15:04:05"),
+		Properties: []junitProperty{
+			{Name: "run", Value: run.ID},
+			{Name: "commit", Value: run.Commit},
+		},
+	}
+	var total time.Duration
+	for _, res := range run.Results {
+		total += res.Duration
+		passed, failed := res.checks()
+		tc := junitTestCase{
+			Name:      res.Test,
+			Classname: run.Suite + "." + res.Cluster,
+			Time:      seconds(res.Duration),
+			Properties: []junitProperty{
+				{Name: "cluster", Value: res.Cluster},
+				{Name: "script", Value: res.Script},
+				{Name: "commit", Value: run.Commit},
+				{Name: "checks_passed", Value: fmt.Sprint(passed)},
+				{Name: "checks_failed", Value: fmt.Sprint(failed)},
+			},
+		}
+		out := []string{fmt.Sprintf("checks: %d passed, %d failed", passed, failed)}
+		out = append(out, res.thresholdLines()...)
+		tc.SystemOut = strings.Join(out, "\n")
+		if f := res.failure(); f != "" {
+			suite.Failures++
+			tc.Failure = &junitFailure{Message: f, Text: strings.Join(res.thresholdLines(), "\n")}
+		}
+		suite.TestCases = append(suite.TestCases, tc)
+	}
+	suite.Time = seconds(total)
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	e := xml.NewEncoder(w)
+	e.Indent("", "  ")
+	if err := e.Encode(junitTestSuites{Suites: []junitTestSuite{suite}}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// writeMarkdown writes a summary table of the run followed by failures.
+func writeMarkdown(w io.Writer, run *TestRun) error {
+	fmt.Fprintf(w, "# Test run %s\n\n", run.ID)
+	fmt.Fprintf(w, "- Suite: %s\n- Commit: %s\n- Started: %s\n\n", run.Suite, dashIfEmpty(run.Commit),
+		run.StartedAt.Format(time.RFC3339))
+	fmt.Fprintln(w, "| Test | Cluster | Duration | Checks passed | Checks failed | Thresholds | Result |")
+	fmt.Fprintln(w, "|------|---------|----------|---------------|---------------|------------|--------|")
+	for _, res := range run.Results {
+		passed, failed := res.checks()
+		thresholds := "-"
+		if res.Summary != nil && len(res.Summary.Thresholds()) > 0 {
+			thresholds = fmt.Sprintf("%d/%d passed", len(res.Summary.Thresholds())-len(res.Failed()),
+				len(res.Summary.Thresholds()))
+		}
+		result := "passed"
+		if res.failure() != "" {
+			result = "**failed**"
+		}
+		fmt.Fprintf(w, "| %s | %s | %s | %d | %d | %s | %s |\n", res.Test, res.Cluster,
+			res.Duration.Round(time.Second), passed, failed, thresholds, result)
+	}
+	failures := []string{}
+	for _, res := range run.Results {
+		if f := res.failure(); f != "" {
+			failures = append(failures, fmt.Sprintf("- %s on %s: %s", res.Test, res.Cluster, f))
+		}
+	}
+	if len(failures) > 0 {
+		fmt.Fprintf(w, "\n## Failures\n\n%s\n", strings.Join(failures, "\n"))
+	}
+	return nil
+}
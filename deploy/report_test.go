@@ -0,0 +1,84 @@
+package deploy
+
+import (
+	"context"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"soil/util"
+)
+
+func testRun() *TestRun {
+	summary, _ := util.ParseK6Summary(testK6Logs)
+	return &TestRun{
+		ID:        "20260102-030405",
+		Suite:     "default",
+		Commit:    "abc123",
+		StartedAt: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		Results: []TestResult{
+			{Test: "create_load", Cluster: "downstream-0", Script: "k6/create_k8s_resources.js",
+				Duration: 90 * time.Second, Summary: summary},
+			{Test: "create_projects", Cluster: "upstream", Script: "k6/create_projects.js",
+				Duration: 2 * time.Second, Error: "exit status 1"},
+		},
+	}
+}
+
+func TestValidateReports(t *testing.T) {
+	assert.NoError(t, ValidateReports(nil))
+	assert.NoError(t, ValidateReports(map[string]string{"junit": "out.xml", "md": "summary.md"}))
+	assert.ErrorContains(t, ValidateReports(map[string]string{"html": "out.html"}), "Unknown report format 'html'")
+	assert.ErrorContains(t, ValidateReports(map[string]string{"md": ""}), "Missing path")
+}
+
+func TestWriteReports(t *testing.T) {
+	dir := t.TempDir()
+	junit := filepath.Join(dir, "out.xml")
+	md := filepath.Join(dir, "summary.md")
+	assert.NoError(t, WriteReports(testRun(), map[string]string{"junit": junit, "md": md}))
+
+	data, err := os.ReadFile(junit)
+	assert.NoError(t, err)
+	var suites junitTestSuites
+	assert.NoError(t, xml.Unmarshal(data, &suites))
+	assert.Len(t, suites.Suites, 1)
+	s := suites.Suites[0]
+	assert.Equal(t, 2, s.Tests)
+	assert.Equal(t, 2, s.Failures)
+	assert.Equal(t, "92.000", s.Time)
+	assert.Contains(t, s.Properties, junitProperty{Name: "commit", Value: "abc123"})
+	assert.Equal(t, "create_load", s.TestCases[0].Name)
+	assert.Equal(t, "default.downstream-0", s.TestCases[0].Classname)
+	assert.Equal(t, "90.000", s.TestCases[0].Time)
+	assert.Contains(t, s.TestCases[0].Properties, junitProperty{Name: "checks_passed", Value: "5"})
+	assert.Equal(t, "thresholds failed: http_req_duration: p(95)<100", s.TestCases[0].Failure.Message)
+	assert.Equal(t, "exit status 1", s.TestCases[1].Failure.Message)
+
+	data, err = os.ReadFile(md)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "- Commit: abc123")
+	assert.Contains(t, string(data), "| create_load | downstream-0 | 1m30s | 5 | 0 | 0/1 passed | **failed** |")
+	assert.Contains(t, string(data), "- create_projects on upstream: exit status 1")
+}
+
+func TestScalabilityDeploymentTestReports(t *testing.T) {
+	d, _ := newTestDeployment(t)
+	junit := filepath.Join(t.TempDir(), "out.xml")
+	Reports = map[string]string{"junit": junit}
+	defer func() { Reports = nil }()
+	assert.NoError(t, d.Test(context.Background()))
+
+	data, err := os.ReadFile(junit)
+	assert.NoError(t, err)
+	var suites junitTestSuites
+	assert.NoError(t, xml.Unmarshal(data, &suites))
+	assert.Equal(t, 3, suites.Suites[0].Tests)
+	assert.Equal(t, 0, suites.Suites[0].Failures)
+
+	Reports = map[string]string{"pdf": "out.pdf"}
+	assert.ErrorContains(t, d.Test(context.Background()), "Unknown report format")
+}
@@ -0,0 +1,219 @@
+package deploy
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"soil/util"
+)
+
+// RUNS_DIR keeps results of test runs in the deployment workdir.
+const RUNS_DIR = "runs"
+
+// TestResult is the outcome of a suite test run against a cluster.
+type TestResult struct {
+	Test     string        `json:"test"`
+	Cluster  string        `json:"cluster"`
+	Script   string        `json:"script"`
+	Duration time.Duration `json:"duration"`
+	// Summary is nil if k6 did not export it, or the result is loaded from history
+	Summary *util.K6Summary `json:"-"`
+	// Metrics are key metrics of the summary kept in the run history
+	Metrics *ResultMetrics `json:"metrics,omitempty"`
+	// File the summary is stored to
+	File string `json:"file,omitempty"`
+	// Error of k6, if it failed
+	Error string `json:"error,omitempty"`
+}
+
+// ResultMetrics are key metrics of the k6 summary, latencies in milliseconds.
+type ResultMetrics struct {
+	Requests         int      `json:"requests"`
+	P95              float64  `json:"p95"`
+	ErrorRate        float64  `json:"error_rate"`
+	ChecksPassed     int      `json:"checks_passed"`
+	ChecksFailed     int      `json:"checks_failed"`
+	FailedThresholds []string `json:"failed_thresholds,omitempty"`
+}
+
+func newResultMetrics(s *util.K6Summary) *ResultMetrics {
+	if s == nil {
+		return nil
+	}
+	passed, failed := s.Checks()
+	m := &ResultMetrics{
+		Requests:     int(s.Value("http_reqs", "count")),
+		P95:          s.Value("http_req_duration", "p(95)"),
+		ErrorRate:    s.Value("http_req_failed", "value"),
+		ChecksPassed: passed,
+		ChecksFailed: failed,
+	}
+	if f := s.FailedThresholds(); len(f) > 0 {
+		m.FailedThresholds = f
+	}
+	return m
+}
+
+// Failed returns thresholds of the test which are not met.
+func (r TestResult) Failed() []string {
+	if r.Summary != nil {
+		return r.Summary.FailedThresholds()
+	}
+	if r.Metrics != nil {
+		return r.Metrics.FailedThresholds
+	}
+	return nil
+}
+
+// Results of test runs
+const (
+	RunPassed = "passed"
+	RunFailed = "failed"
+)
+
+// TestRun is a run of a test suite on the deployment.
+type TestRun struct {
+	ID             string       `json:"id"`
+	Deployment     string       `json:"deployment"`
+	Suite          string       `json:"suite"`
+	RancherVersion string       `json:"rancher_version,omitempty"`
+	Commit         string       `json:"commit,omitempty"`
+	StartedAt      time.Time    `json:"started_at"`
+	FinishedAt     time.Time    `json:"finished_at,omitempty"`
+	Result         string       `json:"result,omitempty"`
+	Results        []TestResult `json:"results"`
+}
+
+// newTestRun starts a run of the suite, the id is unique among runs of the deployment.
+func (d ScalabilityDeployment) newTestRun(suite string) *TestRun {
+	now := time.Now().UTC()
+	id := now.Format("20060102-150405")
+	for i := 2; ; i++ {
+		if _, err := os.Stat(d.runDir(id)); os.IsNotExist(err) {
+			break
+		}
+		id = fmt.Sprintf("%s-%d", now.Format("20060102-150405"), i)
+	}
+	return &TestRun{ID: id, Deployment: d.Name, Suite: suite, StartedAt: now}
+}
+
+// Failed returns results having failed thresholds.
+func (r *TestRun) Failed() []TestResult {
+	failed := []TestResult{}
+	for _, res := range r.Results {
+		if len(res.Failed()) > 0 {
+			failed = append(failed, res)
+		}
+	}
+	return failed
+}
+
+// ThresholdsError reports test results with failed k6 thresholds.
+type ThresholdsError struct {
+	Run *TestRun
+}
+
+func (e *ThresholdsError) Error() string {
+	lines := []string{}
+	for _, res := range e.Run.Failed() {
+		lines = append(lines, fmt.Sprintf("%s on %s: %s", res.Test, res.Cluster, strings.Join(res.Failed(), ", ")))
+	}
+	return fmt.Sprintf("k6 thresholds failed in run %s:\n  - %s", e.Run.ID, strings.Join(lines, "\n  - "))
+}
+
+/**
+ * finishRun: report results of the run, err is the error running the suite.
+ *
+ * Returns ThresholdsError if the suite completed but thresholds failed,
+ * or RegressionError if results regressed against the baseline, if any.
+ */
+func (d ScalabilityDeployment) finishRun(run *TestRun, reports map[string]string, baseline *TestRun, err error) error {
+	run.FinishedAt = time.Now().UTC()
+	run.Result = RunPassed
+	if err != nil || len(run.Failed()) > 0 {
+		run.Result = RunFailed
+	}
+	if len(run.Results) > 0 {
+		fmt.Printf("\nResults of test run %s:\n", run.ID)
+		run.PrintResults(os.Stdout)
+		if serr := d.saveRun(run); serr != nil {
+			log.Printf("*** Unable to save test run: %v", serr)
+		}
+	}
+	if rerr := WriteReports(run, reports); rerr != nil {
+		if err == nil {
+			return rerr
+		}
+		log.Printf("*** %v", rerr)
+	}
+	if err != nil {
+		return err
+	}
+	if len(run.Failed()) > 0 {
+		return &ThresholdsError{Run: run}
+	}
+	if baseline != nil {
+		return compareBaseline(baseline, run)
+	}
+	return nil
+}
+
+// runDir returns the directory keeping results of the test run.
+func (d ScalabilityDeployment) runDir(id string) string {
+	return filepath.Join(d.Workdir(), RUNS_DIR, id)
+}
+
+// saveSummary stores the k6 summary of the result in the run directory.
+func (d ScalabilityDeployment) saveSummary(run *TestRun, res *TestResult) error {
+	if res.Summary == nil {
+		return nil
+	}
+	dir := d.runDir(run.ID)
+	path := filepath.Join(dir, res.Test+"-"+res.Cluster+".json")
+	if util.DryRun {
+		log.Printf("Dry run, skipping saving k6 summary to: %s", path)
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	log.Printf("Saving k6 summary to: %s", path)
+	res.File = path
+	return util.WriteFileAtomic(path, res.Summary.Data, 0644)
+}
+
+func formatMs(ms float64) string {
+	return strconv.FormatFloat(ms, 'f', 2, 64) + "ms"
+}
+
+// PrintResults writes a table of the test results of the run.
+func (r *TestRun) PrintResults(out io.Writer) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TEST\tCLUSTER\tDURATION\tCHECKS\tREQUESTS\tP95\tFAILED\tTHRESHOLDS")
+	for _, res := range r.Results {
+		if res.Summary == nil {
+			fmt.Fprintf(w, "%s\t%s\t%s\t-\t-\t-\t-\t-\n", res.Test, res.Cluster, res.Duration.Round(time.Second))
+			continue
+		}
+		s := res.Summary
+		passed, failed := s.Checks()
+		thresholds := "ok"
+		if f := len(res.Failed()); f > 0 {
+			thresholds = fmt.Sprintf("%d/%d failed", f, len(s.Thresholds()))
+		} else if len(s.Thresholds()) == 0 {
+			thresholds = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d/%d\t%d\t%s\t%.2f%%\t%s\n",
+			res.Test, res.Cluster, res.Duration.Round(time.Second), passed, passed+failed,
+			int(s.Value("http_reqs", "count")), formatMs(s.Value("http_req_duration", "p(95)")),
+			s.Value("http_req_failed", "value")*100, thresholds)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,57 @@
+package deploy
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"soil/util"
+)
+
+const testK6Logs = util.K6_SUMMARY_MARKER + `
+{"metrics": {
+  "checks": {"passes": 5, "fails": 0, "value": 1},
+  "http_req_duration": {"p(95)": 120.5, "thresholds": {"p(95)<100": true}},
+  "http_reqs": {"count": 5}
+}}`
+
+func TestScalabilityDeploymentTestThresholds(t *testing.T) {
+	d, f := newTestDeployment(t)
+	f.On(`^kubectl run k6 .*create_k8s_resources.js`, "", 99).
+		On(`^kubectl --namespace=tester logs k6`, testK6Logs, 0)
+
+	err := d.Test(context.Background())
+	var thresholdsErr *ThresholdsError
+	assert.True(t, errors.As(err, &thresholdsErr))
+	// the remaining tests are run
+	assert.Len(t, f.Matching(`^kubectl run k6 `), 3)
+	assert.Len(t, thresholdsErr.Run.Results, 3)
+	assert.Len(t, thresholdsErr.Run.Failed(), 3)
+	assert.ErrorContains(t, err, "create_load on downstream: http_req_duration: p(95)<100")
+
+	files, _ := filepath.Glob(filepath.Join(d.Workdir(), RUNS_DIR, thresholdsErr.Run.ID, "*-*.json"))
+	assert.Len(t, files, 3)
+	data, _ := os.ReadFile(filepath.Join(d.Workdir(), RUNS_DIR, thresholdsErr.Run.ID, "create_load-downstream.json"))
+	assert.Contains(t, string(data), `"p(95)<100": true`)
+
+	var out strings.Builder
+	assert.NoError(t, thresholdsErr.Run.PrintResults(&out))
+	assert.Contains(t, out.String(), "create_load")
+	assert.Contains(t, out.String(), "120.50ms")
+	assert.Contains(t, out.String(), "1/1 failed")
+}
+
+func TestScalabilityDeploymentTestK6Failed(t *testing.T) {
+	d, f := newTestDeployment(t)
+	f.On(`^kubectl run k6 `, "", 1)
+
+	err := d.Test(context.Background())
+	var stepErr *StepError
+	assert.True(t, errors.As(err, &stepErr))
+	assert.Len(t, f.Matching(`^kubectl run k6 `), 1)
+	assert.Len(t, f.Matching(`delete pod k6`), 2)
+}
@@ -0,0 +1,257 @@
+package deploy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"soil/util"
+)
+
+// RUN_FILE records a test run in its directory under RUNS_DIR.
+const RUN_FILE = "run.json"
+
+// LATEST_RUN refers to the most recent run of the deployment.
+const LATEST_RUN = "latest"
+
+// Baseline is the run `so test` results are compared with, if set.
+var Baseline string
+
+// Tolerances of regressions reported by comparisons of test runs.
+type Tolerances struct {
+	// P95 is the allowed increase of p95 latency in percent
+	P95 float64
+	// ErrorRate is the allowed increase of error rate in percentage points
+	ErrorRate float64
+}
+
+// RegressionTolerances are used by `so test --baseline` and `so test compare`.
+var RegressionTolerances = Tolerances{P95: 10, ErrorRate: 1}
+
+// RegressionError reports results regressed against the baseline run.
+type RegressionError struct {
+	Baseline    string
+	Run         string
+	Regressions []Comparison
+}
+
+func (e *RegressionError) Error() string {
+	lines := []string{}
+	for _, c := range e.Regressions {
+		lines = append(lines, fmt.Sprintf("%s on %s: %s", c.Test, c.Cluster, strings.Join(c.Reasons, ", ")))
+	}
+	return fmt.Sprintf("Run %s regressed against %s:\n  - %s", e.Run, e.Baseline, strings.Join(lines, "\n  - "))
+}
+
+func runsDir(name string) string {
+	return filepath.Join(workdir(name), RUNS_DIR)
+}
+
+// saveRun records the run in the history of the deployment.
+func (d ScalabilityDeployment) saveRun(run *TestRun) error {
+	path := filepath.Join(d.runDir(run.ID), RUN_FILE)
+	if util.DryRun {
+		log.Printf("Dry run, skipping saving test run to: %s", path)
+		return nil
+	}
+	data, err := json.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(d.runDir(run.ID), 0755); err != nil {
+		return err
+	}
+	log.Printf("Saving test run to: %s", path)
+	return util.WriteFileAtomic(path, data, 0644)
+}
+
+/**
+ * ListRuns: test runs of the deployment, the oldest first.
+ */
+func ListRuns(name string) ([]*TestRun, error) {
+	items, err := os.ReadDir(runsDir(name))
+	if os.IsNotExist(err) {
+		return []*TestRun{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	runs := []*TestRun{}
+	for _, item := range items {
+		if !item.IsDir() {
+			continue
+		}
+		run, err := LoadRun(name, item.Name())
+		if errors.Is(err, fs.ErrNotExist) {
+			// summaries of a run interrupted before it was recorded
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].StartedAt.Before(runs[j].StartedAt)
+	})
+	return runs, nil
+}
+
+/**
+ * LoadRun: a recorded test run of the deployment.
+ *
+ * id is a run id, LATEST_RUN, or NAME/ID referring to a run of another deployment.
+ */
+func LoadRun(name string, id string) (*TestRun, error) {
+	if i := strings.LastIndex(id, "/"); i >= 0 {
+		name, id = id[:i], id[i+1:]
+	}
+	if id == LATEST_RUN {
+		runs, err := ListRuns(name)
+		if err != nil {
+			return nil, err
+		}
+		if len(runs) == 0 {
+			return nil, fmt.Errorf("No test runs of deployment '%s'", name)
+		}
+		return runs[len(runs)-1], nil
+	}
+	data, err := os.ReadFile(filepath.Join(runsDir(name), id, RUN_FILE))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("Unknown test run '%s' of deployment '%s': %w", id, name, err)
+		}
+		return nil, err
+	}
+	run := &TestRun{}
+	if err := json.Unmarshal(data, run); err != nil {
+		return nil, fmt.Errorf("Invalid test run '%s': %w", id, err)
+	}
+	return run, nil
+}
+
+// Comparison of a test result on a cluster in two runs.
+type Comparison struct {
+	Test       string
+	Cluster    string
+	A          *ResultMetrics
+	B          *ResultMetrics
+	P95Change  float64
+	ErrorDelta float64
+	// Reasons of a regression, empty if B is within tolerances of A
+	Reasons []string
+}
+
+/**
+ * CompareRuns: compare results of run b with the results of run a.
+ *
+ * Results are matched by test and cluster, a regression is a p95 latency
+ * increase above tol.P95 percent or an error rate increase above
+ * tol.ErrorRate percentage points.
+ */
+func CompareRuns(a *TestRun, b *TestRun, tol Tolerances) []Comparison {
+	before := map[string]*ResultMetrics{}
+	for _, res := range a.Results {
+		before[res.Test+"/"+res.Cluster] = res.Metrics
+	}
+	result := []Comparison{}
+	for _, res := range b.Results {
+		c := Comparison{Test: res.Test, Cluster: res.Cluster, A: before[res.Test+"/"+res.Cluster], B: res.Metrics}
+		if c.A == nil || c.B == nil {
+			result = append(result, c)
+			continue
+		}
+		if c.A.P95 > 0 {
+			c.P95Change = (c.B.P95 - c.A.P95) / c.A.P95 * 100
+		}
+		c.ErrorDelta = (c.B.ErrorRate - c.A.ErrorRate) * 100
+		if c.P95Change > tol.P95 {
+			c.Reasons = append(c.Reasons, fmt.Sprintf("p95 %s -> %s (+%.1f%% > %.1f%%)",
+				formatMs(c.A.P95), formatMs(c.B.P95), c.P95Change, tol.P95))
+		}
+		if c.ErrorDelta > tol.ErrorRate {
+			c.Reasons = append(c.Reasons, fmt.Sprintf("error rate %.2f%% -> %.2f%% (+%.2f > %.2f points)",
+				c.A.ErrorRate*100, c.B.ErrorRate*100, c.ErrorDelta, tol.ErrorRate))
+		}
+		result = append(result, c)
+	}
+	return result
+}
+
+// Regressions returns comparisons beyond tolerances.
+func Regressions(comparisons []Comparison) []Comparison {
+	regressed := []Comparison{}
+	for _, c := range comparisons {
+		if len(c.Reasons) > 0 {
+			regressed = append(regressed, c)
+		}
+	}
+	return regressed
+}
+
+func formatChange(change float64) string {
+	if math.Abs(change) < 0.05 {
+		return "0.0%"
+	}
+	return fmt.Sprintf("%+.1f%%", change)
+}
+
+// PrintComparisons writes a table of p95 latency and error rate changes.
+func PrintComparisons(out io.Writer, comparisons []Comparison) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TEST\tCLUSTER\tP95 A\tP95 B\tCHANGE\tERRORS A\tERRORS B\tRESULT")
+	for _, c := range comparisons {
+		if c.A == nil || c.B == nil {
+			fmt.Fprintf(w, "%s\t%s\t-\t-\t-\t-\t-\tnot comparable\n", c.Test, c.Cluster)
+			continue
+		}
+		result := "ok"
+		if len(c.Reasons) > 0 {
+			result = "REGRESSION"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%.2f%%\t%.2f%%\t%s\n", c.Test, c.Cluster,
+			formatMs(c.A.P95), formatMs(c.B.P95), formatChange(c.P95Change),
+			c.A.ErrorRate*100, c.B.ErrorRate*100, result)
+	}
+	return w.Flush()
+}
+
+// PrintRuns writes a table of test runs.
+func PrintRuns(out io.Writer, runs []*TestRun) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RUN\tSTARTED\tDURATION\tSUITE\tRANCHER\tCOMMIT\tTESTS\tRESULT")
+	for _, r := range runs {
+		duration := "-"
+		if !r.FinishedAt.IsZero() {
+			duration = r.FinishedAt.Sub(r.StartedAt).Round(time.Second).String()
+		}
+		commit := r.Commit
+		if len(commit) > 12 {
+			commit = commit[:12]
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%d\t%s\n", r.ID, r.StartedAt.Local().Format(time.RFC3339),
+			duration, r.Suite, dashIfEmpty(r.RancherVersion), dashIfEmpty(commit), len(r.Results), dashIfEmpty(r.Result))
+	}
+	return w.Flush()
+}
+
+// compareBaseline compares the run with the baseline run.
+func compareBaseline(baseline *TestRun, run *TestRun) error {
+	fmt.Printf("\nComparison with baseline run %s:\n", baseline.ID)
+	comparisons := CompareRuns(baseline, run, RegressionTolerances)
+	PrintComparisons(os.Stdout, comparisons)
+	if regressions := Regressions(comparisons); len(regressions) > 0 {
+		return &RegressionError{Baseline: baseline.ID, Run: run.ID, Regressions: regressions}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package deploy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"soil/util"
+)
+
+func testK6Summary(p95 float64, errorRate float64) string {
+	return util.K6_SUMMARY_MARKER + fmt.Sprintf(`
+{"metrics": {
+  "http_req_duration": {"p(95)": %f},
+  "http_req_failed": {"value": %f},
+  "http_reqs": {"count": 100}
+}}`, p95, errorRate)
+}
+
+func TestCompareRuns(t *testing.T) {
+	a := &TestRun{ID: "a", Results: []TestResult{
+		{Test: "create_load", Cluster: "downstream-0", Metrics: &ResultMetrics{P95: 100, ErrorRate: 0.01}},
+		{Test: "create_load", Cluster: "downstream-1", Metrics: &ResultMetrics{P95: 100, ErrorRate: 0.01}},
+		{Test: "create_projects", Cluster: "upstream", Metrics: &ResultMetrics{P95: 100}},
+	}}
+	b := &TestRun{ID: "b", Results: []TestResult{
+		{Test: "create_load", Cluster: "downstream-0", Metrics: &ResultMetrics{P95: 109, ErrorRate: 0.015}},
+		{Test: "create_load", Cluster: "downstream-1", Metrics: &ResultMetrics{P95: 120, ErrorRate: 0.03}},
+		{Test: "create_projects", Cluster: "upstream"},
+		{Test: "create_roles_users", Cluster: "upstream", Metrics: &ResultMetrics{P95: 100}},
+	}}
+	comparisons := CompareRuns(a, b, Tolerances{P95: 10, ErrorRate: 1})
+	assert.Len(t, comparisons, 4)
+	regressions := Regressions(comparisons)
+	assert.Len(t, regressions, 1)
+	assert.Equal(t, "downstream-1", regressions[0].Cluster)
+	assert.InDelta(t, 20.0, regressions[0].P95Change, 0.001)
+	assert.Len(t, regressions[0].Reasons, 2)
+
+	assert.Empty(t, Regressions(CompareRuns(a, b, Tolerances{P95: 25, ErrorRate: 5})))
+
+	var out strings.Builder
+	assert.NoError(t, PrintComparisons(&out, comparisons))
+	assert.Contains(t, out.String(), "REGRESSION")
+	assert.Contains(t, out.String(), "not comparable")
+}
+
+func TestScalabilityDeploymentTestBaseline(t *testing.T) {
+	d, _ := newTestDeployment(t)
+	d.Executor = newTestExecutor().On(`logs k6`, testK6Summary(100, 0), 0)
+	assert.NoError(t, d.Test(context.Background()))
+
+	runs, err := ListRuns(d.Name)
+	assert.NoError(t, err)
+	assert.Len(t, runs, 1)
+	first := runs[0]
+	assert.Equal(t, DEFAULT_SUITE, first.Suite)
+	assert.Equal(t, "2.7.6", first.RancherVersion)
+	assert.Equal(t, RunPassed, first.Result)
+	assert.Len(t, first.Results, 3)
+	assert.Equal(t, 100.0, first.Results[0].Metrics.P95)
+
+	Baseline = LATEST_RUN
+	defer func() { Baseline = "" }()
+	d.Executor = newTestExecutor().On(`logs k6`, testK6Summary(105, 0), 0)
+	assert.NoError(t, d.Test(context.Background()))
+
+	d.Executor = newTestExecutor().On(`logs k6`, testK6Summary(150, 0.05), 0)
+	err = d.Test(context.Background())
+	var regressionErr *RegressionError
+	assert.True(t, errors.As(err, &regressionErr))
+	assert.Len(t, regressionErr.Regressions, 3)
+	assert.NotEqual(t, first.ID, regressionErr.Run)
+
+	runs, err = ListRuns(d.Name)
+	assert.NoError(t, err)
+	assert.Len(t, runs, 3)
+	latest, err := LoadRun(d.Name, LATEST_RUN)
+	assert.NoError(t, err)
+	assert.Equal(t, regressionErr.Run, latest.ID)
+	_, err = LoadRun(d.Name, d.Name+"/"+first.ID)
+	assert.NoError(t, err)
+
+	Baseline = "missing"
+	assert.ErrorContains(t, d.Test(context.Background()), "Unknown test run 'missing'")
+}
@@ -1,21 +1,20 @@
 package deploy
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 	"reflect"
 	"soil/util"
-	"strconv"
+	"sort"
 	"strings"
+	"time"
 )
 
-const RANCHER_VERSION = "2.7.6"
-const RANCHER_CHART = "https://releases.rancher.com/server-charts/latest/rancher-2.7.6.tgz"
-const RANCHER_IMAGE_TAG = "v2.7.6"
-const CERT_MANAGER_CHART = "https://charts.jetstack.io/charts/cert-manager-v1.8.0.tgz"
-const GRAFANA_CHART = "https://github.com/grafana/helm-charts/releases/download/grafana-6.56.5/grafana-6.56.5.tgz"
-
 var ADMIN_PASSWORD string = "adminadminadmin"
 var TerraformWorkDir string
 var TerraformVarFile string
@@ -29,69 +28,54 @@ type ScalabilityDeployment struct {
 	TerraformVarFile string `json:"terraform_var_file"`
 	RancherReplicas  int    `json:"rancher_replicas"`
 	Kind             string `json:"kind"`
+	// KindPlugin is set if the kind is provided by a so-kind-NAME executable
+	KindPlugin      bool      `json:"kind_plugin,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+	Phase           string    `json:"phase,omitempty"`
+	CompletedPhases []string  `json:"completed_phases,omitempty"`
+	State           string    `json:"state,omitempty"`
+	// TerraformVars are passed to terraform in addition to TerraformVarFile
+	TerraformVars map[string]any   `json:"terraform_vars,omitempty"`
+	Charts        map[string]Chart `json:"charts,omitempty"`
+	TestSuite     string           `json:"test_suite,omitempty"`
+	History       []HistoryEntry   `json:"history,omitempty"`
+	// Inventory of hosts of the ssh kind, see InventoryFile
+	Inventory *Inventory `json:"inventory,omitempty"`
+	// Soilfile the deployment is created from, if any
+	Soilfile *Soilfile `json:"-"`
+	// Executor runs external commands, the default one if nil
+	Executor util.Executor `json:"-"`
+}
+
+func (d ScalabilityDeployment) run() util.Runner {
+	return util.NewRunner(d.Executor)
 }
 
-func (d ScalabilityDeployment) saveStatus() {
+func (d ScalabilityDeployment) saveStatus() error {
 	log.Printf("Saving status for: %s", reflect.TypeOf(d))
-	saveStatus(&d)
-}
-
-func (d ScalabilityDeployment) CheckRequirements() (result bool) {
-	/*
-		ScalabilityTests needs:
-		- terraform
-		- kubectl
-		- helm
-		- git
-	*/
-	result = true
-	gitVersion, err := util.ShellQuietOutput("git --version")
-	if err != nil {
-		log.Printf("Error: no git found, please install git")
-		result = false
-	} else {
-		log.Printf("Found git version: %s", util.SplitLast(strings.TrimSpace(gitVersion), " "))
-	}
-	kubectlVersion, err := util.ShellQuietUnmarshalJson("kubectl version --client=true -o=json 2>/dev/null")
-	if err != nil {
-		log.Printf("Error: no kubectl found, please install kubectl")
-		result = false
-	} else {
-		ver, _ := kubectlVersion["kustomizeVersion"]
-		log.Printf("Found kubectl version: %s", ver)
+	return saveStatus(&d)
+}
+
+// saveFailedStatus saves the status of a failed phase, the phase error
+// is more relevant than a failure to save the status, so it is only logged.
+func (d ScalabilityDeployment) saveFailedStatus() {
+	if err := d.saveStatus(); err != nil {
+		log.Printf("*** %v", err)
 	}
+}
 
-	terraformVersion, err := util.ShellQuietUnmarshalJson("terraform version -json")
+// CheckRequirements checks tools required by the kind of the deployment are
+// installed and the cluster provider is ready.
+func (d ScalabilityDeployment) CheckRequirements(ctx context.Context) bool {
+	result := checkTools(ctx, d.run(), d.kind().Tools)
+	p, err := d.provider()
 	if err != nil {
-		log.Printf("Error: no terraform found, please install terraform from " +
-			"https://releases.hashicorp.com/terraform/")
-		result = false
-	} else {
-		ver, _ := terraformVersion["terraform_version"]
-		log.Printf("Found terraform version: %s", ver)
-
+		log.Printf("Error: %v", err)
+		return false
 	}
-	helmVersion, err := util.ShellQuietOutput("helm version --template='{{.Version}}'")
-	if err != nil {
-		log.Printf("Error: no helm found, try:\n" +
-			"    curl https://raw.githubusercontent.com/helm/helm/main/scripts/get-helm-3 | bash\n" +
-			"or:\n" +
-			"    curl https://raw.githubusercontent.com/helm/helm/main/scripts/get-helm-3 | " +
-			"HELM_INSTALL_DIR=$HOME/bin USE_SUDO=false bash")
+	for _, problem := range p.Requirements(ctx, d) {
+		log.Printf("Error: %s", problem)
 		result = false
-	} else {
-		log.Printf("Found helm version: %s", helmVersion)
-	}
-	if d.Kind == "aws" {
-		awsVersion, err := util.ShellQuietOutput("aws --version")
-		if err != nil {
-			log.Printf("Error: no aws cli found, please install aws, for details refer: " +
-				"https://docs.aws.amazon.com/cli/latest/userguide/getting-started-install.html")
-			result = false
-		} else {
-			ver := strings.Split(strings.TrimSpace(awsVersion), " ")[0]
-			log.Printf("Found aws cli version: %s", ver)
-		}
 	}
 	return result
 }
@@ -104,17 +88,43 @@ func (d ScalabilityDeployment) Brief() string {
 	return fmt.Sprintf("%s (%s)", d.Name, k)
 }
 
+// chartVersions returns versions of charts, e.g. "rancher 2.7.6, grafana 6.56.5".
+func (d ScalabilityDeployment) chartVersions() string {
+	versions := []string{}
+	for _, name := range versionedCharts {
+		if v := d.Charts[name].Version; v != "" {
+			versions = append(versions, name+" "+v)
+		}
+	}
+	return strings.Join(versions, ", ")
+}
+
 func (d ScalabilityDeployment) String() string {
 	banner := fmt.Sprintf("'%s' (%s):\n", d.Name, d.Kind) +
 		fmt.Sprintf("  scalability-tests:\n") +
 		fmt.Sprintf("    repo: %s\n", d.Repo) +
 		fmt.Sprintf("    dir: %s\n", d.TerraformWorkDir) +
-		fmt.Sprintf("    rancher replicas: %v\n", d.RancherReplicas)
-	details := d.TextAccessDetails()
+		fmt.Sprintf("    rancher replicas: %v\n", d.RancherReplicas) +
+		fmt.Sprintf("  charts: %s\n", d.chartVersions()) +
+		fmt.Sprintf("  created: %s\n", formatTime(d.CreatedAt)) +
+		fmt.Sprintf("  state: %s\n", d.State) +
+		fmt.Sprintf("  completed phases: %s\n", strings.Join(d.CompletedPhases, ", "))
+	if len(d.History) > 0 {
+		banner += "  history:\n"
+		for _, h := range d.History {
+			banner += fmt.Sprintf("    %s\n", h)
+		}
+	}
+	return banner
+}
+
+// Describe returns the deployment status followed by cluster access details.
+func (d ScalabilityDeployment) Describe(ctx context.Context) string {
+	details := d.TextAccessDetails(ctx)
 	if details == "" {
-		return banner
+		return d.String()
 	}
-	return banner + "    " + strings.Replace(details, "\n", "\n    ", -1)
+	return d.String() + "    " + strings.Replace(details, "\n", "\n    ", -1)
 }
 
 func (d ScalabilityDeployment) Extra() map[string]interface{} {
@@ -140,8 +150,8 @@ func (d ScalabilityDeployment) getRepoLocalPath() (path string) {
 	return
 }
 
-func (d ScalabilityDeployment) getRepo() {
-	util.CloneGitRepo(d.Repo, d.getRepoLocalPath())
+func (d ScalabilityDeployment) getRepo(ctx context.Context) error {
+	return stepError("git clone", d.run().CloneGitRepo(ctx, d.Repo, d.getRepoLocalPath()))
 }
 
 /**
@@ -149,15 +159,25 @@ func (d ScalabilityDeployment) getRepo() {
  *
  * Returns deployment workdir path.
  */
-func (d ScalabilityDeployment) Make() (path string) {
-	path = d.makeWorkdir(&d)
-	//saveStatus(&d)
-	d.saveStatus()
-
-	d.getRepo()
-	// run terraform
-	d.Run()
-	// run install
+func (d ScalabilityDeployment) Make(ctx context.Context) (path string, err error) {
+	path, err = d.makeWorkdir(&d)
+	if err != nil {
+		return
+	}
+	if err = d.saveStatus(); err != nil {
+		return
+	}
+	if d.Soilfile != nil {
+		if err = saveSoilfile(path, d.Soilfile); err != nil {
+			return
+		}
+	}
+
+	if err = d.getRepo(ctx); err != nil {
+		return
+	}
+	// run terraform and install
+	err = d.Run(ctx)
 	return
 }
 
@@ -169,14 +189,29 @@ func (d ScalabilityDeployment) StatusFile() string {
 	return d.CommonDeployment.StatusFile()
 }
 
-func (d ScalabilityDeployment) Remove(force bool) {
+func (d ScalabilityDeployment) Remove(ctx context.Context, force bool) error {
 	log.Printf("Removing deployment %s", d.DName())
-	tfWorkdir := d.getRepoLocalPath() + "/" + d.TerraformWorkDir
-	tfState := d.getTerraformStatePath()
-	util.Exec("terraform", "-chdir="+tfWorkdir, "destroy", "-auto-approve", "-state="+tfState)
+	p, err := d.provider()
+	if err != nil {
+		// clusters of the plugin would be orphaned if the workdir was removed
+		return err
+	}
+	err = p.Destroy(ctx, d)
+	if err != nil {
+		// an interrupted destroy leaves resources, the state is still needed to remove them
+		if !force || ctx.Err() != nil {
+			return err
+		}
+		log.Printf("*** Destroy failed, removing workdir anyway: %v", err)
+	}
 	if force {
-		os.RemoveAll(d.Workdir())
+		if util.DryRun {
+			fmt.Printf("rm -rf %s\n", d.Workdir())
+			return nil
+		}
+		return os.RemoveAll(d.Workdir())
 	}
+	return nil
 }
 
 func (d ScalabilityDeployment) TerraformVarFilePath() (path string) {
@@ -200,37 +235,118 @@ func (d ScalabilityDeployment) getTerraformStatePath() string {
 	return d.Workdir() + "/terraform.state"
 }
 
-func (d ScalabilityDeployment) getClusters() (map[string]any, error) {
-	path := d.getTerraformStatePath()
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		log.Fatalf("Terraform status file does not exist: %s", path)
-		return nil, err
+// dryRunOutputs returns placeholder terraform outputs for dry run.
+func dryRunOutputs() *TerraformOutputs {
+	o := &TerraformOutputs{Clusters: map[string]Cluster{}}
+	for _, name := range []string{"tester", "upstream", "downstream"} {
+		o.Clusters[name] = Cluster{
+			Name:               name,
+			LocalName:          "<" + name + ".local_name>",
+			PrivateName:        "<" + name + ".private_name>",
+			Kubeconfig:         "<" + name + ".kubeconfig>",
+			Context:            "<" + name + ".context>",
+			NodeAccessCommands: map[string]string{},
+		}
 	}
+	return o
+}
 
-	status, err := util.ExecQuietUnmarshalJson("terraform",
-		"-chdir="+d.getTerraformWorkDir(),
-		"output", "-json",
-		"-state="+d.getTerraformStatePath())
-
+func (d ScalabilityDeployment) getOutputs(ctx context.Context) (*TerraformOutputs, error) {
+	if util.DryRun {
+		return dryRunOutputs(), nil
+	}
+	p, err := d.provider()
 	if err != nil {
 		return nil, err
 	}
-	clusters := status["clusters"].(map[string]any)["value"].(map[string]any)
-	return clusters, nil
+	return p.Outputs(ctx, d)
 }
 
 func (d ScalabilityDeployment) getChartsDir() string {
 	return d.getRepoLocalPath() + "/charts"
 }
 
-func (d ScalabilityDeployment) Run() {
-	//configName := util.SplitLast(d.TerraformWorkDir, "/")
-	//tfWorkdir := d.getRepoLocalPath() + "/" + d.TerraformWorkDir
+const RANCHER_BOOTSTRAP_PASSWORD = "admin"
+
+/**
+ * Run: execute deployment phases selected by Resume, FromPhase and OnlyPhase.
+ *
+ * Every completed phase is checkpointed in the status file, so an interrupted
+ * deployment can be continued with `so deploy --resume`.
+ */
+func (d ScalabilityDeployment) Run(ctx context.Context) error {
+	names, err := SelectPhases(d.CompletedPhases, Resume, FromPhase, OnlyPhase)
+	if err != nil {
+		return err
+	}
+	if !Resume && FromPhase == "" && OnlyPhase == "" {
+		d.CompletedPhases = nil
+	}
+	for _, name := range names {
+		p := lookupPhase(name)
+		log.Printf("*** Phase '%s': %s", p.Name, p.Description)
+		d.Phase = p.Name
+		d.State = StateDeploying
+		if err := d.saveStatus(); err != nil {
+			return err
+		}
+		phaseCtx, cancel := withTimeout(ctx, PhaseTimeout)
+		err := p.Run(d, phaseCtx)
+		timedOut := phaseCtx.Err() == context.DeadlineExceeded
+		cancel()
+		if ctx.Err() != nil {
+			log.Printf("*** Phase '%s' interrupted: %v", p.Name, ctx.Err())
+			d.State = StateInterrupted
+			d.saveFailedStatus()
+			return fmt.Errorf("Phase '%s' interrupted: %w", p.Name, ctx.Err())
+		}
+		if timedOut {
+			log.Printf("*** Phase '%s' timed out after %v", p.Name, PhaseTimeout)
+			d.State = StateFailed
+			d.saveFailedStatus()
+			return fmt.Errorf("Phase '%s' timed out after %v: %w", p.Name, PhaseTimeout, context.DeadlineExceeded)
+		}
+		if err != nil {
+			log.Printf("*** Phase '%s' failed: %v", p.Name, err)
+			d.State = StateFailed
+			d.saveFailedStatus()
+			var stepErr *StepError
+			if errors.As(err, &stepErr) {
+				stepErr.Phase = p.Name
+			}
+			return err
+		}
+		d.CompletedPhases = completePhase(d.CompletedPhases, p.Name)
+		if err := d.saveStatus(); err != nil {
+			return err
+		}
+	}
+	d.State = StateDeployed
+	return d.saveStatus()
+}
+
+// writeTerraformVars saves TerraformVars to a var file in the workdir.
+func (d ScalabilityDeployment) writeTerraformVars() (string, error) {
+	path := d.Workdir() + "/terraform.tfvars.json"
+	data, err := json.MarshalIndent(d.TerraformVars, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if util.DryRun {
+		fmt.Printf("cat > %s <<EOF\n%s\nEOF\n", path, data)
+		return path, nil
+	}
+	return path, util.WriteFileAtomic(path, data, 0644)
+}
+
+func (d ScalabilityDeployment) applyTerraform(ctx context.Context) error {
 	// {scalability-tests}/terraform/examples/ssh.tfvars.json
 	varFilePath := d.TerraformVarFilePath()
 
 	initCmd := fmt.Sprintf(`terraform -chdir=%s init -upgrade`, d.getTerraformWorkDir())
-	util.Shell(initCmd)
+	if _, err := d.run().Shell(ctx, initCmd); err != nil {
+		return stepError("terraform init", err)
+	}
 	applyCmd := []string{
 		"terraform",
 		"-chdir=" + d.getTerraformWorkDir(),
@@ -240,31 +356,46 @@ func (d ScalabilityDeployment) Run() {
 	if varFilePath != "" {
 		applyCmd = append(applyCmd, "-var-file="+varFilePath)
 	}
-	_, err := util.Exec(applyCmd...)
-	if err != nil {
-		log.Panicf("%v", err)
+	if len(d.TerraformVars) > 0 {
+		path, err := d.writeTerraformVars()
+		if err != nil {
+			return err
+		}
+		applyCmd = append(applyCmd, "-var-file="+path)
+	}
+	if _, err := d.run().Exec(ctx, applyCmd...); err != nil {
+		return stepError("terraform apply", err)
 	}
-	status, _ := util.ExecUnmarshalJson("terraform",
+	status, err := d.run().ExecUnmarshalJson(ctx, "terraform",
 		"-chdir="+d.getTerraformWorkDir(),
 		"output", "-json",
 		"-state="+d.getTerraformStatePath())
 	log.Printf("Terraform Status: %#v", status)
-	clusters := status["clusters"].(map[string]any)["value"].(map[string]any)
-	log.Printf("Terraform Clusters: %v", clusters)
-	localCharts := d.getRepoLocalPath() + "/charts"
+	return stepError("terraform output", err)
+}
 
-	tester := clusters["tester"].(map[string]any)
-	upstream := clusters["upstream"].(map[string]any)
-	testerLocalName := tester["local_name"].(string)
-	testerPrivateName := tester["private_name"].(string)
-	upstreamLocalName := upstream["local_name"].(string)
-	upstreamPrivateName := upstream["private_name"].(string)
+func (d ScalabilityDeployment) installTester(ctx context.Context) error {
+	outputs, err := d.getOutputs(ctx)
+	if err != nil {
+		return err
+	}
+	log.Printf("Terraform Clusters: %v", outputs.Clusters)
+	localCharts := d.getChartsDir()
+
+	tester := outputs.Tester()
+	testerLocalName := tester.LocalName
 
 	log.Printf("Terraform Tester: %#v", tester)
 	log.Printf("*** Installing helm charts to tester cluster '%s' from %s", testerLocalName, localCharts)
-	util.HelmInstall("mimir", localCharts+"/mimir", tester, "tester", nil)
-	util.HelmInstall("k6-files", localCharts+"/k6-files", tester, "tester", nil)
-	util.HelmInstall("grafana-dashboards", localCharts+"/grafana-dashboards", tester, "tester", nil)
+	if err := d.helmInstall(ctx, "mimir", localCharts+"/mimir", tester, "tester", nil); err != nil {
+		return err
+	}
+	if err := d.helmInstall(ctx, "k6-files", localCharts+"/k6-files", tester, "tester", nil); err != nil {
+		return err
+	}
+	if err := d.helmInstall(ctx, "grafana-dashboards", localCharts+"/grafana-dashboards", tester, "tester", nil); err != nil {
+		return err
+	}
 	grafanaJson := map[string]interface{}{
 		"datasources": map[string]interface{}{
 			"datasources.yaml": map[string]interface{}{
@@ -310,17 +441,34 @@ func (d ScalabilityDeployment) Run() {
 		},
 		"adminPassword": ADMIN_PASSWORD,
 	}
-	util.HelmInstall("grafana", GRAFANA_CHART, tester, "tester", grafanaJson)
+	return d.helmInstall(ctx, "grafana", d.chartURL("grafana"), tester, "tester", grafanaJson)
+}
+
+func (d ScalabilityDeployment) installCertManager(ctx context.Context) error {
+	outputs, err := d.getOutputs(ctx)
+	if err != nil {
+		return err
+	}
+	upstream := outputs.Upstream()
 	log.Printf("*** Upstream Cluster")
 	certmanagerJson := map[string]interface{}{"installCRDs": true}
-	util.HelmInstall("cert-manager", CERT_MANAGER_CHART, upstream, "cert-manager", certmanagerJson)
-	const RANCHER_BOOTSTRAP_PASSWORD = "admin"
+	return d.helmInstall(ctx, "cert-manager", d.chartURL("cert-manager"), upstream, "cert-manager", certmanagerJson)
+}
+
+func (d ScalabilityDeployment) installRancher(ctx context.Context) error {
+	outputs, err := d.getOutputs(ctx)
+	if err != nil {
+		return err
+	}
+	upstream := outputs.Upstream()
+	upstreamLocalName := upstream.LocalName
+	upstreamPrivateName := upstream.PrivateName
 	rancherPrivateUrl := "https://" + upstreamPrivateName
 	rancherJson := map[string]interface{}{
 		"bootstrapPassword": RANCHER_BOOTSTRAP_PASSWORD,
 		"hostname":          upstreamPrivateName,
 		"replicas":          d.RancherReplicas,
-		"rancherImageTag":   RANCHER_IMAGE_TAG,
+		"rancherImageTag":   "v" + d.Charts["rancher"].Version,
 		"extraEnv": []interface{}{
 			map[string]interface{}{
 				"name":  "CATTLE_SERVER_URL",
@@ -337,48 +485,55 @@ func (d ScalabilityDeployment) Run() {
 			"periodSeconds":       3600,
 		},
 	}
-	util.HelmInstall("rancher", RANCHER_CHART, upstream, "cattle-system", rancherJson)
+	if err := d.helmInstall(ctx, "rancher", d.chartURL("rancher"), upstream, "cattle-system", rancherJson); err != nil {
+		return err
+	}
 	rancherIngressJson := map[string]interface{}{"san": upstreamLocalName}
-	util.HelmInstall("rancher-ingress", localCharts+"/rancher-ingress", upstream, "default", rancherIngressJson)
-	restrictions := map[string]any{}
-	if d.Kind == "k3d" {
-		restrictions = map[string]any{
-			"nodeSelector": map[string]any{
-				"monitoring": "true",
-			},
-			"tolerations": []any{
-				map[string]any{
-					"key":      "monitoring",
-					"operator": "Exists",
-					"effect":   "NoSchedule",
-				},
-			},
-		}
+	return d.helmInstall(ctx, "rancher-ingress", d.getChartsDir()+"/rancher-ingress", upstream, "default", rancherIngressJson)
+}
+
+func (d ScalabilityDeployment) installUpstreamMonitoring(ctx context.Context) error {
+	outputs, err := d.getOutputs(ctx)
+	if err != nil {
+		return err
+	}
+	tester := outputs.Tester()
+	upstream := outputs.Upstream()
+	testerPrivateName := tester.PrivateName
+	restrictions := d.kind().MonitoringRestrictions
+	if restrictions == nil {
+		restrictions = map[string]any{}
 	}
 
-	d.installRancherMonitoring(upstream, restrictions, "http://"+testerPrivateName+"/mimir/api/v1/push")
+	err = d.installRancherMonitoring(ctx, upstream, restrictions, "http://"+testerPrivateName+"/mimir/api/v1/push")
+	if err != nil {
+		return err
+	}
 
-	util.HelmInstall("cgroups-exporter", localCharts+"/cgroups-exporter", upstream, "cattle-monitoring-system", nil)
+	return d.helmInstall(ctx, "cgroups-exporter", d.getChartsDir()+"/cgroups-exporter", upstream, "cattle-monitoring-system", nil)
+}
 
-	upstreamKubeConfig := upstream["kubeconfig"].(string)
-	upstreamContext := upstream["context"].(string)
-	util.Exec("kubectl", "wait", "deployment/rancher", "--namespace", "cattle-system",
-		"--for", "condition=Available=true", "--timeout=1h",
-		"--kubeconfig="+upstreamKubeConfig,
-		"--context="+upstreamContext,
-	)
+func (d ScalabilityDeployment) importDownstreamClusters(ctx context.Context) error {
+	outputs, err := d.getOutputs(ctx)
+	if err != nil {
+		return err
+	}
+	tester := outputs.Tester()
+	upstream := outputs.Upstream()
+	upstreamPrivateName := upstream.PrivateName
+	rancherPrivateUrl := "https://" + upstreamPrivateName
 
-	// *** Step 3: Import downstream clusters
-	rancherLocalUrl := clusterLocalUrl(upstream)
-	importedClusters := map[string]any{}
-	for k, v := range clusters {
-		if strings.HasPrefix(k, "downstream") {
-			importedClusters[k] = v
-		}
+	upstreamKubeConfig := upstream.Kubeconfig
+	upstreamContext := upstream.Context
+	if err := d.waitRancher(ctx, upstream); err != nil {
+		return err
 	}
+
+	rancherLocalUrl := upstream.LocalUrl()
+	importedClusters := outputs.Downstream()
 	importedClusterNames := []string{}
-	for k, _ := range importedClusters {
-		importedClusterNames = append(importedClusterNames, k)
+	for _, c := range importedClusters {
+		importedClusterNames = append(importedClusterNames, c.Name)
 	}
 
 	k6Env := map[string]string{
@@ -387,60 +542,114 @@ func (d ScalabilityDeployment) Run() {
 		"PASSWORD":               ADMIN_PASSWORD,
 		"IMPORTED_CLUSTER_NAMES": strings.Join(importedClusterNames, ","),
 	}
-	util.K6Run(tester, k6Env, nil, "k6/rancher_setup.js", false, true)
-	j := map[string]any{}
-	for name, cluster := range importedClusters {
-		j, _ = util.ExecUnmarshalJson("kubectl",
+	_, err = d.run().K6Run(ctx, tester.Access(), k6Env, nil, "k6/rancher_setup.js", false, true)
+	if err != nil {
+		return stepError("k6 rancher_setup.js", err)
+	}
+	for _, cluster := range importedClusters {
+		name := cluster.Name
+		j, err := d.run().ExecUnmarshalJson(ctx, "kubectl",
 			"--kubeconfig="+upstreamKubeConfig,
 			"--context="+upstreamContext,
 			"get", "-n", "fleet-default", "cluster", name,
 			"-o", "json",
 		)
+		if err != nil {
+			return stepError("kubectl get cluster "+name, err)
+		}
 		log.Printf("Fleet %#v", j)
-		clusterId := j["status"].(map[string]any)["clusterName"].(string)
-		j, _ = util.ExecUnmarshalJson("kubectl", "get", "-n", clusterId,
+		clusterId, err := statusField(j, "clusterName")
+		if err != nil {
+			return stepError("kubectl get cluster "+name, err)
+		}
+		j, err = d.run().ExecUnmarshalJson(ctx, "kubectl", "get", "-n", clusterId,
 			"clusterregistrationtoken.management.cattle.io", "default-token", "-o", "json",
 			"--kubeconfig="+upstreamKubeConfig,
 			"--context="+upstreamContext,
 		)
-		token := j["status"].(map[string]any)["token"].(string)
+		if err != nil {
+			return stepError("kubectl get clusterregistrationtoken "+clusterId, err)
+		}
+		token, err := statusField(j, "token")
+		if err != nil {
+			return stepError("kubectl get clusterregistrationtoken "+clusterId, err)
+		}
 		clusterYaml := token + "_" + clusterId + ".yaml"
 		clusterYamlPath := d.Workdir() + "/" + clusterYaml
 		clusterYamlUrl := rancherLocalUrl + "/v3/import/" + clusterYaml
-		util.Exec("curl", "--insecure", "-fL", clusterYamlUrl, "-o", clusterYamlPath)
-		util.Exec("cat", clusterYamlPath)
-		util.KubeCtl(cluster.(map[string]any), "apply", "-f", clusterYamlPath)
+		if _, err := d.run().Exec(ctx, "curl", "--insecure", "-fL", clusterYamlUrl, "-o", clusterYamlPath); err != nil {
+			return stepError("curl "+clusterYamlUrl, err)
+		}
+		d.run().Exec(ctx, "cat", clusterYamlPath)
+		if err := d.run().KubeCtl(ctx, cluster.Access(), "apply", "-f", clusterYamlPath); err != nil {
+			return stepError("kubectl apply "+clusterYaml, err)
+		}
 	}
 
-	util.Exec("kubectl", "wait", "clusters.management.cattle.io", "--all",
-		"--for", "condition=ready=true", "--timeout=1h",
-		"--kubeconfig="+upstreamKubeConfig,
-		"--context="+upstreamContext,
+	return d.waitClusters(ctx, upstream, len(importedClusters) > 0)
+}
+
+// waitRancher waits until rancher deployment on the upstream cluster is available.
+func (d ScalabilityDeployment) waitRancher(ctx context.Context, upstream Cluster) error {
+	_, err := d.run().Exec(ctx, "kubectl", "wait", "deployment/rancher", "--namespace", "cattle-system",
+		"--for", "condition=Available=true", "--timeout="+WaitTimeout.String(),
+		"--kubeconfig="+upstream.Kubeconfig,
+		"--context="+upstream.Context,
 	)
+	return stepError("kubectl wait deployment/rancher", err)
+}
 
-	if len(importedClusters) > 0 {
-		util.Exec("kubectl", "wait", "cluster.fleet.cattle.io", "--all", "--namespace", "fleet-default",
-			"--for", "condition=ready=true", "--timeout=1h",
-			"--kubeconfig="+upstreamKubeConfig,
-			"--context="+upstreamContext,
-		)
+// waitClusters waits until clusters managed by rancher, and fleet clusters
+// of imported ones, are ready.
+func (d ScalabilityDeployment) waitClusters(ctx context.Context, upstream Cluster, imported bool) error {
+	_, err := d.run().Exec(ctx, "kubectl", "wait", "clusters.management.cattle.io", "--all",
+		"--for", "condition=ready=true", "--timeout="+WaitTimeout.String(),
+		"--kubeconfig="+upstream.Kubeconfig,
+		"--context="+upstream.Context,
+	)
+	if err != nil {
+		return stepError("kubectl wait clusters.management.cattle.io", err)
 	}
-
-	for _, cluster := range importedClusters {
-		d.installRancherMonitoring(cluster.(map[string]any), map[string]any{}, "")
+	if !imported {
+		return nil
 	}
+	_, err = d.run().Exec(ctx, "kubectl", "wait", "cluster.fleet.cattle.io", "--all", "--namespace", "fleet-default",
+		"--for", "condition=ready=true", "--timeout="+WaitTimeout.String(),
+		"--kubeconfig="+upstream.Kubeconfig,
+		"--context="+upstream.Context,
+	)
+	return stepError("kubectl wait cluster.fleet.cattle.io", err)
 }
 
-func clusterLocalUrl(cluster map[string]any) string {
-	localName := cluster["local_name"].(string)
-	localPort := fmt.Sprintf("%v", cluster["local_https_port"])
-	return "https://" + localName + ":" + localPort
+// statusField returns a string field of a kubernetes object status,
+// or a placeholder if running dry.
+func statusField(j map[string]any, field string) (string, error) {
+	if util.DryRun {
+		return "<" + field + ">", nil
+	}
+	status, _ := j["status"].(map[string]any)
+	value, ok := status[field].(string)
+	if !ok {
+		return "", fmt.Errorf("No status field '%s' found", field)
+	}
+	return value, nil
 }
 
-func (d ScalabilityDeployment) installRancherMonitoring(cluster map[string]any, restrictions map[string]any, mimirUrl string) {
-	const RANCHER_MONITORING_CHART = "https://github.com/rancher/charts/raw/release-v2.7/assets/rancher-monitoring/rancher-monitoring-102.0.0%2Bup40.1.2.tgz"
-	const RANCHER_MONITORING_CRD_CHART = "https://github.com/rancher/charts/raw/release-v2.7/assets/rancher-monitoring-crd/rancher-monitoring-crd-102.0.0%2Bup40.1.2.tgz"
+func (d ScalabilityDeployment) installDownstreamMonitoring(ctx context.Context) error {
+	outputs, err := d.getOutputs(ctx)
+	if err != nil {
+		return err
+	}
+	for _, cluster := range outputs.Downstream() {
+		err := d.installRancherMonitoring(ctx, cluster, map[string]any{}, "")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
+func (d ScalabilityDeployment) installRancherMonitoring(ctx context.Context, cluster Cluster, restrictions map[string]any, mimirUrl string) error {
 	rancherMonitoringCrd := map[string]any{
 		"global": map[string]any{
 			"cattle": map[string]any{
@@ -452,7 +661,9 @@ func (d ScalabilityDeployment) installRancherMonitoring(cluster map[string]any,
 		"systemDefaultRegistry": "",
 	}
 
-	util.HelmInstall("rancher-monitoring-crd", RANCHER_MONITORING_CRD_CHART, cluster, "cattle-monitoring-system", rancherMonitoringCrd)
+	if err := d.helmInstall(ctx, "rancher-monitoring-crd", d.chartURL("rancher-monitoring-crd"), cluster, "cattle-monitoring-system", rancherMonitoringCrd); err != nil {
+		return err
+	}
 	remoteWrite := []any{}
 	if mimirUrl != "" {
 		remoteWrite = []any{
@@ -539,150 +750,208 @@ func (d ScalabilityDeployment) installRancherMonitoring(cluster map[string]any,
 		"systemDefaultRegistry": "",
 	}
 
-	util.HelmInstall("rancher-monitoring", RANCHER_MONITORING_CHART, cluster, "cattle-monitoring-system", rancherMonitoring)
+	return d.helmInstall(ctx, "rancher-monitoring", d.chartURL("rancher-monitoring"), cluster, "cattle-monitoring-system", rancherMonitoring)
 }
 
-func HelmInstall(name string, chart string, cluster map[string]any, namespace string, values map[string]any) {
-	log.Printf("json %#v", values)
-	util.Exec("helm",
-		"--kubeconfig="+cluster["kubeconfig"].(string),
-		"--kube-context="+cluster["context"].(string),
-		"upgrade", "--install",
-		"--namespace="+namespace,
-		name, chart,
-		"--create-namespace",
-		"--set-json='"+util.HelmJson(values)+"'",
-	)
+// chartURL returns URL of the chart of the release recorded in the status.
+func (d ScalabilityDeployment) chartURL(name string) string {
+	return chartURL(name, d.Charts)
+}
+
+// mergeValues returns values with overrides merged recursively.
+func mergeValues(values map[string]any, overrides map[string]any) map[string]any {
+	merged := map[string]any{}
+	for k, v := range values {
+		merged[k] = v
+	}
+	for k, v := range overrides {
+		vm, ok1 := merged[k].(map[string]any)
+		om, ok2 := v.(map[string]any)
+		if ok1 && ok2 {
+			merged[k] = mergeValues(vm, om)
+		} else {
+			merged[k] = v
+		}
+	}
+	return merged
 }
 
-func textNodeAccessCommands(cluster map[string]any) string {
-	nodeAccessCommands := cluster["node_access_commands"].(map[string]any)
+func (d ScalabilityDeployment) helmInstall(ctx context.Context, name string, chart string, cluster Cluster, namespace string, values map[string]any) error {
+	if overrides := d.Charts[name].Values; len(overrides) > 0 {
+		values = mergeValues(values, overrides)
+	}
+	return stepError("helm install "+name, d.run().HelmInstall(ctx, name, chart, cluster.Access(), namespace, values))
+}
+
+func textNodeAccessCommands(cluster Cluster) string {
+	nodes := []string{}
+	for node := range cluster.NodeAccessCommands {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
 	text := ""
-	for node, command := range nodeAccessCommands {
-		text += fmt.Sprintf("    Node %s: %s\n", node, command)
+	for _, node := range nodes {
+		text += fmt.Sprintf("    Node %s: %s\n", node, cluster.NodeAccessCommands[node])
 	}
 	return text
 
 }
-func (d ScalabilityDeployment) TextAccessDetails() string {
-	clusters, _ := d.getClusters()
-	tester := clusters["tester"].(map[string]any)
-	upstream := clusters["upstream"].(map[string]any)
+func (d ScalabilityDeployment) TextAccessDetails(ctx context.Context) string {
+	outputs, err := d.getOutputs(ctx)
+	if err != nil {
+		log.Printf("No access details: %v", err)
+		return ""
+	}
+	return textAccessDetails(outputs)
+}
 
-	testerLocalPort := fmt.Sprintf("%v", tester["local_http_port"])
-	testerLocalName := tester["local_name"].(string)
+func textAccessDetails(outputs *TerraformOutputs) string {
+	tester := outputs.Tester()
+	upstream := outputs.Upstream()
 
-	upstreamLocalPort := fmt.Sprintf("%v", upstream["local_https_port"])
-	upstreamLocalName := upstream["local_name"].(string)
-	upstreamKubeConfig := upstream["kubeconfig"].(string)
-	downstreamClusters := map[string]any{}
-	for k, v := range clusters {
-		if strings.HasPrefix(k, "downstream") {
-			downstreamClusters[k] = v
-		}
-	}
+	upstreamKubeConfig := upstream.Kubeconfig
 	text := ""
-	rancherUrl := "https://" + upstreamLocalName + ":" + upstreamLocalPort + " (admin/" + ADMIN_PASSWORD + ")"
+	rancherUrl := upstream.LocalUrl() + " (admin/" + ADMIN_PASSWORD + ")"
 	text += "*** ACCESS DETAILS" +
 		"\n*** UPSTREAM CLUSTER" +
 		"\n    Rancher UI: " + rancherUrl +
 		"\n    Kubernetes API:" +
 		"\n      export KUBECONFIG=" + upstreamKubeConfig +
-		"\n      kubectl config use-context " + upstream["context"].(string) +
+		"\n      kubectl config use-context " + upstream.Context +
 		"\n" + textNodeAccessCommands(upstream)
 
-	for name, cluster := range downstreamClusters {
-		downstream := cluster.(map[string]any)
-		text += "\n*** " + strings.ToUpper(name) + " CLUSTER" +
+	for _, downstream := range outputs.Downstream() {
+		text += "\n*** " + strings.ToUpper(downstream.Name) + " CLUSTER" +
 			"\n    Kubernetes API:" +
-			"\n      export KUBECONFIG=" + downstream["kubeconfig"].(string) +
-			"\n      kubectl config use-context " + downstream["context"].(string) +
+			"\n      export KUBECONFIG=" + downstream.Kubeconfig +
+			"\n      kubectl config use-context " + downstream.Context +
 			"\n" + textNodeAccessCommands(downstream)
 	}
-	grafanaUrl := "http://" + testerLocalName + ":" + testerLocalPort +
-		"/grafana/d/a1508c35-b2e6-47f4-94ab-fec400d1c243/test-results?orgId=1&refresh=5s&from=now-30m&to=now" +
-		" (admin/" + ADMIN_PASSWORD + ")"
+	grafanaUrl := tester.GrafanaUrl() + " (admin/" + ADMIN_PASSWORD + ")"
 
 	text += "\n*** TESTER CLUSTER" +
 		"\n    Grafana UI: " + grafanaUrl +
 		"\n" + textNodeAccessCommands(tester)
 	return text
 }
-func (d ScalabilityDeployment) Test() {
-	fmt.Printf("Running tests on the deployment: %s...\n", d.DName())
-	clusters, _ := d.getClusters()
-	tester := clusters["tester"].(map[string]any)
-	upstream := clusters["upstream"].(map[string]any)
 
-	upstreamPrivateName := upstream["private_name"].(string)
-	// Refresh k6 files on the tester cluster
-	util.HelmInstall("k6-files", d.getChartsDir()+"/k6-files", tester, "tester", nil)
+// suiteName returns the test suite selected by SuiteName, or of the deployment.
+func (d ScalabilityDeployment) suiteName() string {
+	if SuiteName != "" {
+		return SuiteName
+	}
+	return d.TestSuite
+}
+
+/**
+ * Test: run tests of the selected suite against the deployment.
+ */
+func (d ScalabilityDeployment) Test(ctx context.Context) error {
+	return d.test(ctx, Reports, Baseline)
+}
 
-	// Create config maps
-	commit := util.GetRepoHead(d.getRepoLocalPath())
-	log.Printf("Got git HEAD: %s", commit)
-	downstreamClusters := map[string]any{}
-	for k, v := range clusters {
-		if strings.HasPrefix(k, "downstream") {
-			downstreamClusters[k] = v
+// test runs the suite writing the reports, results are compared with the
+// baseline run if set.
+func (d ScalabilityDeployment) test(ctx context.Context, reports map[string]string, baselineID string) error {
+	if err := ValidateReports(reports); err != nil {
+		return err
+	}
+	if err := validateK6Runner(K6Runner); err != nil {
+		return err
+	}
+	suite, err := LoadSuite(d.suiteName())
+	if err != nil {
+		return err
+	}
+	vars, err := suite.WithVars(SuiteVars)
+	if err != nil {
+		return err
+	}
+	var baseline *TestRun
+	if baselineID != "" {
+		if baseline, err = LoadRun(d.Name, baselineID); err != nil {
+			return err
 		}
 	}
-	const CONFIG_MAP_COUNT = 1000
-	const SECRET_COUNT = 1000
-	const ROLE_COUNT = 10
-	const USER_COUNT = 5
-	const PROJECT_COUNT = 20
-
-	for name, cluster := range downstreamClusters {
-		downstream := cluster.(map[string]any)
-		privateName := downstream["private_name"].(string)
-		vars := map[string]string{
-			"BASE_URL":         "https://" + privateName + ":6443",
-			"KUBECONFIG":       downstream["kubeconfig"].(string),
-			"CONTEXT":          downstream["context"].(string),
-			"CONFIG_MAP_COUNT": strconv.Itoa(CONFIG_MAP_COUNT),
-			"SECRET_COUNT":     strconv.Itoa(SECRET_COUNT),
+	fmt.Printf("Running test suite '%s' on the deployment: %s...\n", suite.Name, d.DName())
+	outputs, err := d.getOutputs(ctx)
+	if err != nil {
+		return err
+	}
+	k6, err := d.newK6Runner(ctx, suite, outputs)
+	if err != nil {
+		return err
+	}
+	defer k6.close()
+
+	commit := d.run().GetRepoHead(ctx, d.getRepoLocalPath())
+	log.Printf("Got git HEAD: %s", commit)
+	run := d.newTestRun(suite.Name)
+	run.RancherVersion = d.Charts["rancher"].Version
+	run.Commit = commit
+	err = d.runSuite(ctx, k6, run, suite, vars, outputs)
+	log.Print(textAccessDetails(outputs))
+	return d.finishRun(run, reports, baseline, err)
+}
+
+// runSuite runs tests of the suite, results are added to the run.
+func (d ScalabilityDeployment) runSuite(ctx context.Context, k6 *k6Runner, run *TestRun, suite *Suite,
+	vars map[string]string, outputs *TerraformOutputs) error {
+	tester := outputs.Tester()
+	upstream := outputs.Upstream()
+	for _, t := range suite.Tests {
+		clusters, err := selectClusters(outputs, t.Clusters)
+		if err != nil {
+			return fmt.Errorf("Test '%s': %w", t.Name, err)
 		}
-		tags := map[string]string{
-			"commit":     commit,
-			"cluster":    name,
-			"test":       "create_load.mjs",
-			"ConfigMaps": strconv.Itoa(CONFIG_MAP_COUNT),
-			"Secrets":    strconv.Itoa(SECRET_COUNT),
+		for _, cluster := range clusters {
+			rancherUrl, apiUrl, err := k6.urls(ctx, cluster)
+			if err != nil {
+				return err
+			}
+			sc := SuiteContext{
+				Cluster:       cluster,
+				Upstream:      upstream,
+				Tester:        tester,
+				Vars:          vars,
+				Commit:        run.Commit,
+				AdminPassword: ADMIN_PASSWORD,
+				RancherUrl:    rancherUrl,
+				ApiUrl:        apiUrl,
+			}
+			env, err := renderTemplates(t.Env, sc)
+			if err != nil {
+				return fmt.Errorf("Test '%s' env: %w", t.Name, err)
+			}
+			tags, err := renderTemplates(t.Tags, sc)
+			if err != nil {
+				return fmt.Errorf("Test '%s' tags: %w", t.Name, err)
+			}
+			tags["commit"] = run.Commit
+			tags["cluster"] = cluster.Name
+			// identifies metrics of all k6 pods of the run
+			tags["run_id"] = run.ID
+			if _, ok := tags["test"]; !ok {
+				tags["test"] = t.Name
+			}
+			script := filepath.Base(t.Script)
+			fmt.Printf("Running test '%s' on %s...\n", t.Name, cluster.Name)
+			started := time.Now()
+			summary, err := k6.run(ctx, env, tags, t.Script, t.Record, t.Pods)
+			res := TestResult{Test: t.Name, Cluster: cluster.Name, Script: t.Script,
+				Duration: time.Since(started), Summary: summary, Metrics: newResultMetrics(summary)}
+			if err != nil {
+				res.Error = err.Error()
+			}
+			if serr := d.saveSummary(run, &res); serr != nil {
+				log.Printf("*** Unable to save k6 summary: %v", serr)
+			}
+			run.Results = append(run.Results, res)
+			// failed thresholds do not stop the suite, they are reported at the end
+			if err != nil && len(res.Failed()) == 0 {
+				return stepError("k6 "+script+" on "+cluster.Name, err)
+			}
 		}
-
-		util.K6Run(tester, vars, tags, "k6/create_k8s_resources.js", true, true)
-	}
-	// create users and roles
-	vars := map[string]string{
-		"BASE_URL":   "https://" + upstreamPrivateName + ":443",
-		"USERNAME":   "admin",
-		"PASSWORD":   ADMIN_PASSWORD,
-		"ROLE_COUNT": strconv.Itoa(ROLE_COUNT),
-		"USER_COUNT": strconv.Itoa(USER_COUNT),
-	}
-	tags := map[string]string{
-		"commit":  commit,
-		"cluster": "upstream",
-		"test":    "create_roles_users.mjs",
-		"Roles":   strconv.Itoa(ROLE_COUNT),
-		"Users":   strconv.Itoa(USER_COUNT),
-	}
-	util.K6Run(tester, vars, tags, "k6/create_roles_users.js", true, true)
-
-	// create projects
-	vars = map[string]string{
-		"BASE_URL":      "https://" + upstreamPrivateName + ":443",
-		"USERNAME":      "admin",
-		"PASSWORD":      ADMIN_PASSWORD,
-		"PROJECT_COUNT": strconv.Itoa(PROJECT_COUNT),
-	}
-	tags = map[string]string{
-		"commit":   commit,
-		"cluster":  "upstream",
-		"test":     "create_projects.mjs",
-		"Projects": strconv.Itoa(PROJECT_COUNT),
-	}
-	util.K6Run(tester, vars, tags, "k6/create_projects.js", true, true)
-	log.Printf(d.TextAccessDetails())
+	}
+	return nil
 }
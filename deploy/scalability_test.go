@@ -0,0 +1,125 @@
+package deploy
+
+import (
+	"context"
+	"os"
+	"soil/util"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testTerraformOutput = `{"clusters": {"value": {
+	"tester": {"local_name": "tester.local.gd", "private_name": "tester.private", "kubeconfig": "/tmp/tester.yaml",
+		"context": "k3d-tester", "local_http_port": 8080, "local_https_port": 8443, "node_access_commands": {}},
+	"upstream": {"local_name": "upstream.local.gd", "private_name": "upstream.private", "kubeconfig": "/tmp/upstream.yaml",
+		"context": "k3d-upstream", "local_http_port": 8081, "local_https_port": 8444, "node_access_commands": {}},
+	"downstream": {"local_name": "downstream.local.gd", "private_name": "downstream.private", "kubeconfig": "/tmp/downstream.yaml",
+		"context": "k3d-downstream", "local_http_port": 8082, "local_https_port": 8445, "node_access_commands": {}}
+}}}`
+
+func newTestExecutor() *util.FakeExecutor {
+	return util.NewFakeExecutor().
+		On(`^terraform .* output -json`, testTerraformOutput, 0).
+		On(`get -n fleet-default cluster downstream`, `{"status": {"clusterName": "c-m-abcdef"}}`, 0).
+		On(`clusterregistrationtoken`, `{"status": {"token": "secret"}}`, 0)
+}
+
+func newTestDeployment(t *testing.T) (ScalabilityDeployment, *util.FakeExecutor) {
+	t.Setenv("HOME", t.TempDir())
+	f := newTestExecutor()
+	md, err := MakeDeployment("test", testKind(t, "k3d"))
+	assert.NoError(t, err)
+	d := md.(ScalabilityDeployment)
+	d.Repo = "https://github.com/moio/scalability-tests"
+	d.Executor = f
+	assert.NoError(t, os.MkdirAll(d.Workdir(), 0755))
+	assert.NoError(t, os.WriteFile(d.getTerraformStatePath(), []byte("{}"), 0644))
+	return d, f
+}
+
+func TestScalabilityDeploymentMake(t *testing.T) {
+	d, f := newTestDeployment(t)
+	_, err := d.Make(context.Background())
+	assert.NoError(t, err)
+
+	assert.Len(t, f.Matching(`^git clone https://github.com/moio/scalability-tests `), 1)
+	assert.Len(t, f.Matching(`^terraform .* apply -auto-approve`), 1)
+	assert.Len(t, f.Matching(`^helm .* rancher https://releases.rancher.com/.*rancherImageTag="v2.7.6"`), 1)
+	assert.Len(t, f.Matching(`^kubectl apply -f .*/secret_c-m-abcdef.yaml --kubeconfig=/tmp/downstream.yaml`), 1)
+	assert.Len(t, f.Matching(`^helm --kubeconfig=/tmp/downstream.yaml .* rancher-monitoring `), 1)
+
+	s, err := LookupDeployment("test")
+	assert.NoError(t, err)
+	assert.Equal(t, PhaseNames(), s.(*ScalabilityDeployment).CompletedPhases)
+	assert.Equal(t, StateDeployed, s.(*ScalabilityDeployment).State)
+}
+
+func TestScalabilityDeploymentInterrupted(t *testing.T) {
+	d, _ := newTestDeployment(t)
+	// skip cloning, so that the deployment is interrupted at the first phase
+	assert.NoError(t, os.MkdirAll(d.getRepoLocalPath(), 0755))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := d.Make(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	s, err := LookupDeployment("test")
+	assert.NoError(t, err)
+	assert.Empty(t, s.(*ScalabilityDeployment).CompletedPhases)
+	assert.Equal(t, StateInterrupted, s.(*ScalabilityDeployment).State)
+	assert.Equal(t, PhaseTerraform, s.(*ScalabilityDeployment).Phase)
+}
+
+func TestScalabilityDeploymentTest(t *testing.T) {
+	d, f := newTestDeployment(t)
+	assert.NoError(t, d.Test(context.Background()))
+
+	assert.Len(t, f.Matching(`^kubectl run k6 `), 3)
+	assert.Len(t, f.Matching(`create secret generic kube --from-file=config=/tmp/downstream.yaml`), 1)
+}
+
+func TestScalabilityDeploymentRemove(t *testing.T) {
+	d, f := newTestDeployment(t)
+	assert.NoError(t, d.Remove(context.Background(), true))
+
+	assert.Len(t, f.Matching(`^terraform .* destroy -auto-approve`), 1)
+	assert.NoDirExists(t, d.Workdir())
+}
+
+func TestScalabilityDeploymentRemoveForced(t *testing.T) {
+	d, f := newTestDeployment(t)
+	f.On(`^terraform .* destroy`, "", 1)
+	assert.NoError(t, d.Remove(context.Background(), true))
+	assert.NoDirExists(t, d.Workdir())
+
+	// interrupted destroy keeps the terraform state
+	d, _ = newTestDeployment(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, d.Remove(ctx, true), context.Canceled)
+	assert.FileExists(t, d.getTerraformStatePath())
+}
+
+func TestScalabilityDeploymentStepFailed(t *testing.T) {
+	d, f := newTestDeployment(t)
+	f.On(`^helm .* rancher https://`, "", 1)
+	_, err := d.Make(context.Background())
+
+	var stepErr *StepError
+	assert.ErrorAs(t, err, &stepErr)
+	assert.Equal(t, PhaseRancher, stepErr.Phase)
+	assert.Equal(t, "helm install rancher", stepErr.Step)
+	assert.Empty(t, f.Matching(`rancher-ingress`))
+
+	s, err := LookupDeployment("test")
+	assert.NoError(t, err)
+	assert.Equal(t, StateFailed, s.(*ScalabilityDeployment).State)
+	assert.Equal(t, []string{PhaseTerraform, PhaseTester, PhaseCertManager}, s.(*ScalabilityDeployment).CompletedPhases)
+}
+
+func TestLookupDeploymentNotFound(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	_, err := LookupDeployment("nothing")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
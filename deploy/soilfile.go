@@ -0,0 +1,228 @@
+package deploy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	"soil/util"
+)
+
+// SOILFILE is the name of the Soilfile stored in the deployment workdir.
+const SOILFILE = "Soilfile.yaml"
+
+// DEFAULT_SUITE is the test suite run by `so test` unless another is given.
+const DEFAULT_SUITE = "default"
+
+// DOWNSTREAM_COUNT_VAR is the terraform variable for downstream_clusters.
+const DOWNSTREAM_COUNT_VAR = "downstream_cluster_count"
+
+// Soilfile declares a whole deployment, so it can be reproduced.
+type Soilfile struct {
+	Name               string            `yaml:"name,omitempty"`
+	Kind               string            `yaml:"kind"`
+	Terraform          SoilfileTerraform `yaml:"terraform,omitempty"`
+	Replicas           int               `yaml:"replicas,omitempty"`
+	DownstreamClusters int               `yaml:"downstream_clusters,omitempty"`
+	Charts             map[string]Chart  `yaml:"charts,omitempty"`
+	Test               SoilfileTest      `yaml:"test,omitempty"`
+}
+
+type SoilfileTerraform struct {
+	Repo    string         `yaml:"repo,omitempty"`
+	WorkDir string         `yaml:"work_dir,omitempty"`
+	VarFile string         `yaml:"var_file,omitempty"`
+	Vars    map[string]any `yaml:"vars,omitempty"`
+}
+
+type SoilfileTest struct {
+	Suite string `yaml:"suite,omitempty"`
+}
+
+// Chart overrides version, URL and values of a helm release installed by deployment.
+type Chart struct {
+	Version string         `json:"version,omitempty" yaml:"version,omitempty"`
+	URL     string         `json:"url,omitempty" yaml:"url,omitempty"`
+	Values  map[string]any `json:"values,omitempty" yaml:"values,omitempty"`
+}
+
+// releases are all helm releases installed by deployments.
+var releases = []string{
+	"cert-manager", "cgroups-exporter", "grafana", "grafana-dashboards", "k6-files", "mimir",
+	"rancher", "rancher-ingress", "rancher-monitoring", "rancher-monitoring-crd",
+}
+
+// SoilfileError lists all problems found in a Soilfile.
+type SoilfileError struct {
+	File     string
+	Problems []string
+}
+
+func (e *SoilfileError) Error() string {
+	return fmt.Sprintf("Invalid Soilfile '%s':\n  - %s", e.File, strings.Join(e.Problems, "\n  - "))
+}
+
+/**
+ * LoadSoilfile: read the Soilfile, unknown fields are rejected.
+ *
+ * The Soilfile is not validated, so that it can be amended with
+ * command line options before Validate.
+ */
+func LoadSoilfile(path string) (*Soilfile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sf := &Soilfile{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(sf); err != nil && !errors.Is(err, io.EOF) {
+		return nil, &SoilfileError{File: path, Problems: []string{err.Error()}}
+	}
+	return sf, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks the Soilfile, file is used in the error only.
+func (sf *Soilfile) Validate(file string) error {
+	problems := []string{}
+	if sf.Kind == "" {
+		problems = append(problems, "kind is required")
+	} else if _, err := LookupKind(sf.Kind); err != nil {
+		problems = append(problems, fmt.Sprintf("unknown kind '%s', expected one of: %s",
+			sf.Kind, strings.Join(KindNames(), ", ")))
+	}
+	if sf.Replicas < 0 {
+		problems = append(problems, "replicas must not be negative")
+	}
+	if sf.DownstreamClusters < 0 {
+		problems = append(problems, "downstream_clusters must not be negative")
+	}
+	if _, ok := sf.Terraform.Vars[DOWNSTREAM_COUNT_VAR]; ok && sf.DownstreamClusters > 0 {
+		problems = append(problems, fmt.Sprintf("terraform.vars.%s conflicts with downstream_clusters",
+			DOWNSTREAM_COUNT_VAR))
+	}
+	names := []string{}
+	for name := range sf.Charts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		chart := sf.Charts[name]
+		if !contains(releases, name) {
+			problems = append(problems, fmt.Sprintf("unknown chart '%s', expected one of: %s",
+				name, strings.Join(releases, ", ")))
+			continue
+		}
+		if chart.URL != "" && !contains(remoteCharts, name) {
+			problems = append(problems, fmt.Sprintf("url of chart '%s' can not be changed", name))
+		}
+		if chart.Version == "" {
+			continue
+		}
+		if !contains(versionedCharts, name) {
+			problems = append(problems, fmt.Sprintf("version of chart '%s' can not be changed", name))
+		} else if !versionPattern.MatchString(chart.Version) {
+			problems = append(problems, fmt.Sprintf("invalid version '%s' of chart '%s'", chart.Version, name))
+		}
+	}
+	if sf.Charts["rancher-monitoring"].Version == "" && versionPattern.MatchString(sf.rancherVersion()) {
+		if _, err := monitoringVersion(sf.rancherVersion()); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if sf.Test.Suite != "" {
+		if _, err := LoadSuite(sf.Test.Suite); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if len(problems) > 0 {
+		return &SoilfileError{File: file, Problems: problems}
+	}
+	return nil
+}
+
+func (sf *Soilfile) rancherVersion() string {
+	if v := sf.Charts["rancher"].Version; v != "" {
+		return v
+	}
+	return RancherVersion
+}
+
+/**
+ * MakeSoilfileDeployment: create deployment declared by the Soilfile.
+ *
+ * The Soilfile must be validated.
+ */
+func MakeSoilfileDeployment(name string, sf *Soilfile) (Deployment, error) {
+	kind, err := LookupKind(sf.Kind)
+	if err != nil {
+		return nil, err
+	}
+	if sf.Terraform.Repo != "" {
+		kind.TerraformRepoRef = sf.Terraform.Repo
+	} else {
+		kind.TerraformRepoRef = TerraformRepoRef
+	}
+	if sf.Terraform.WorkDir != "" {
+		kind.TerraformWorkDir = sf.Terraform.WorkDir
+	}
+	if sf.Terraform.VarFile != "" {
+		kind.TerraformVarFile = sf.Terraform.VarFile
+	}
+	charts, err := resolveCharts(sf.Charts)
+	if err != nil {
+		return nil, err
+	}
+	d := makeDeployment(name, kind, charts)
+	if sf.Replicas > 0 {
+		d.RancherReplicas = sf.Replicas
+	}
+	vars := map[string]any{}
+	for k, v := range sf.Terraform.Vars {
+		vars[k] = v
+	}
+	if sf.DownstreamClusters > 0 {
+		vars[DOWNSTREAM_COUNT_VAR] = sf.DownstreamClusters
+	}
+	if len(vars) > 0 {
+		d.TerraformVars = vars
+	}
+	if InventoryFile != "" {
+		if err := d.applyInventory(InventoryFile); err != nil {
+			return nil, err
+		}
+	}
+	d.TestSuite = sf.Test.Suite
+	d.Soilfile = sf
+	return d, nil
+}
+
+// saveSoilfile stores the Soilfile alongside the status file.
+func saveSoilfile(workdir string, sf *Soilfile) error {
+	data, err := yaml.Marshal(sf)
+	if err != nil {
+		return err
+	}
+	path := workdir + "/" + SOILFILE
+	if util.DryRun {
+		log.Printf("Dry run, skipping saving Soilfile to: %s", path)
+		return nil
+	}
+	log.Printf("Saving Soilfile to: %s", path)
+	return util.WriteFileAtomic(path, data, 0644)
+}
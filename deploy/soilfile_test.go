@@ -0,0 +1,98 @@
+package deploy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testSoilfile = `
+name: perf
+kind: k3d
+terraform:
+  repo: https://github.com/moio/scalability-tests
+  vars:
+    region: eu-west-1
+downstream_clusters: 2
+replicas: 2
+charts:
+  rancher:
+    version: 2.7.9
+    values:
+      auditLog:
+        level: 1
+test:
+  suite: default
+`
+
+func writeSoilfile(t *testing.T, data string) string {
+	path := filepath.Join(t.TempDir(), SOILFILE)
+	assert.NoError(t, os.WriteFile(path, []byte(data), 0644))
+	return path
+}
+
+func TestLoadSoilfile(t *testing.T) {
+	path := writeSoilfile(t, testSoilfile)
+	sf, err := LoadSoilfile(path)
+	assert.NoError(t, err)
+	assert.NoError(t, sf.Validate(path))
+	assert.Equal(t, "k3d", sf.Kind)
+	assert.Equal(t, 2, sf.DownstreamClusters)
+	assert.Equal(t, "2.7.9", sf.Charts["rancher"].Version)
+}
+
+func TestLoadSoilfileUnknownField(t *testing.T) {
+	_, err := LoadSoilfile(writeSoilfile(t, "kind: k3d\nreplica: 1\n"))
+	var sfErr *SoilfileError
+	assert.ErrorAs(t, err, &sfErr)
+}
+
+func TestSoilfileValidate(t *testing.T) {
+	sf := &Soilfile{
+		Kind:     "nope",
+		Replicas: -1,
+		Charts: map[string]Chart{
+			"mimir":   {Version: "1.0.0"},
+			"rancher": {Version: "latest"},
+		},
+		Test: SoilfileTest{Suite: "nope"},
+	}
+	err := sf.Validate("Soilfile.yaml")
+	var sfErr *SoilfileError
+	assert.ErrorAs(t, err, &sfErr)
+	assert.Len(t, sfErr.Problems, 5)
+}
+
+func TestMakeSoilfileDeployment(t *testing.T) {
+	_, f := newTestDeployment(t)
+	sf, err := LoadSoilfile(writeSoilfile(t, testSoilfile))
+	assert.NoError(t, err)
+	md, err := MakeSoilfileDeployment("test", sf)
+	assert.NoError(t, err)
+	d := md.(ScalabilityDeployment)
+	d.Executor = f
+	assert.Equal(t, 2, d.RancherReplicas)
+	assert.Equal(t, map[string]any{"region": "eu-west-1", DOWNSTREAM_COUNT_VAR: 2}, d.TerraformVars)
+
+	_, err = d.Make(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, f.Matching(`^terraform .* apply .*-var-file=.*/terraform.tfvars.json`), 1)
+	assert.Len(t, f.Matching(`^helm .* rancher .*/rancher-2.7.9.tgz .*auditLog={"level":1}.*rancherImageTag="v2.7.9"`), 1)
+
+	stored, err := LoadSoilfile(filepath.Join(d.Workdir(), SOILFILE))
+	assert.NoError(t, err)
+	assert.Equal(t, sf, stored)
+	s, err := LookupDeployment("test")
+	assert.NoError(t, err)
+	assert.Equal(t, "2.7.9", s.(*ScalabilityDeployment).Charts["rancher"].Version)
+}
+
+func TestMergeValues(t *testing.T) {
+	merged := mergeValues(
+		map[string]any{"a": 1, "b": map[string]any{"c": 2, "d": 3}},
+		map[string]any{"b": map[string]any{"d": 4}, "e": 5})
+	assert.Equal(t, map[string]any{"a": 1, "b": map[string]any{"c": 2, "d": 4}, "e": 5}, merged)
+}
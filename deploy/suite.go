@@ -0,0 +1,211 @@
+package deploy
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed suites/*.yaml
+var builtinSuites embed.FS
+
+// SuiteName selects the test suite run by `so test`, the one of the deployment
+// or DEFAULT_SUITE if empty.
+var SuiteName string
+
+// SuiteVars override vars of the test suite.
+var SuiteVars map[string]string
+
+// Cluster selectors of suite tests, any other selector is a cluster name.
+const (
+	SelectUpstream   = "upstream"
+	SelectDownstream = "downstream"
+	SelectTester     = "tester"
+	SelectAll        = "all"
+)
+
+// Suite is a set of k6 tests declared in YAML.
+type Suite struct {
+	Name        string            `yaml:"name"`
+	Description string            `yaml:"description,omitempty"`
+	Vars        map[string]string `yaml:"vars,omitempty"`
+	Tests       []SuiteTest       `yaml:"tests"`
+	// File the suite is loaded from, empty for built-in suites
+	File string `yaml:"-"`
+}
+
+// SuiteTest is a k6 script run against every selected cluster, env and tags
+// are templates of SuiteContext.
+type SuiteTest struct {
+	Name     string `yaml:"name"`
+	Script   string `yaml:"script"`
+	Clusters string `yaml:"clusters"`
+	Record   bool   `yaml:"record,omitempty"`
+	// Pods run k6 in parallel, each one an execution segment of the test, 1 if unset
+	Pods int               `yaml:"pods,omitempty"`
+	Env  map[string]string `yaml:"env,omitempty"`
+	Tags map[string]string `yaml:"tags,omitempty"`
+}
+
+// SuiteContext is available in templates of suite test env and tags.
+type SuiteContext struct {
+	Cluster       Cluster
+	Upstream      Cluster
+	Tester        Cluster
+	Vars          map[string]string
+	Commit        string
+	AdminPassword string
+	// RancherUrl and ApiUrl of Cluster are reachable by the k6 runner
+	RancherUrl string
+	ApiUrl     string
+}
+
+func suitesDir() string {
+	return filepath.Join(SoilHome(), "suites")
+}
+
+/**
+ * LoadSuite: load test suite by name or path.
+ *
+ * A name is looked up as NAME.yaml in the suites directory of soil home,
+ * then among built-in suites.
+ */
+func LoadSuite(name string) (*Suite, error) {
+	if name == "" {
+		name = DEFAULT_SUITE
+	}
+	path := name
+	if !strings.ContainsRune(name, os.PathSeparator) && filepath.Ext(name) == "" {
+		path = filepath.Join(suitesDir(), name+".yaml")
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) && path != name {
+		path = ""
+		data, err = builtinSuites.ReadFile("suites/" + name + ".yaml")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unknown test suite '%s': %w", name, err)
+	}
+	s := &Suite{File: path}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(s); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("Invalid test suite '%s': %w", name, err)
+	}
+	if s.Name == "" {
+		s.Name = name
+	}
+	return s, s.Validate()
+}
+
+func parseTemplates(values map[string]string) error {
+	for k, v := range values {
+		if _, err := template.New(k).Option("missingkey=error").Parse(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate checks the suite has tests with scripts and valid templates.
+func (s *Suite) Validate() error {
+	problems := []string{}
+	if len(s.Tests) == 0 {
+		problems = append(problems, "no tests")
+	}
+	for i, t := range s.Tests {
+		name := t.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		if t.Script == "" {
+			problems = append(problems, fmt.Sprintf("test %s: script is required", name))
+		}
+		if t.Clusters == "" {
+			problems = append(problems, fmt.Sprintf("test %s: clusters is required", name))
+		}
+		if t.Pods < 0 {
+			problems = append(problems, fmt.Sprintf("test %s: pods must not be negative", name))
+		}
+		if err := parseTemplates(t.Env); err != nil {
+			problems = append(problems, fmt.Sprintf("test %s: env: %v", name, err))
+		}
+		if err := parseTemplates(t.Tags); err != nil {
+			problems = append(problems, fmt.Sprintf("test %s: tags: %v", name, err))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("Invalid test suite '%s':\n  - %s", s.Name, strings.Join(problems, "\n  - "))
+	}
+	return nil
+}
+
+// WithVars returns vars of the suite overridden by vars, which must be declared.
+func (s *Suite) WithVars(vars map[string]string) (map[string]string, error) {
+	result := map[string]string{}
+	for k, v := range s.Vars {
+		result[k] = v
+	}
+	unknown := []string{}
+	for k, v := range vars {
+		if _, ok := s.Vars[k]; !ok {
+			unknown = append(unknown, k)
+		}
+		result[k] = v
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		declared := []string{}
+		for k := range s.Vars {
+			declared = append(declared, k)
+		}
+		sort.Strings(declared)
+		return nil, fmt.Errorf("Test suite '%s' has no vars: %s, expected: %s",
+			s.Name, strings.Join(unknown, ", "), strings.Join(declared, ", "))
+	}
+	return result, nil
+}
+
+// selectClusters returns clusters of the outputs matching the selector.
+func selectClusters(outputs *TerraformOutputs, selector string) ([]Cluster, error) {
+	switch selector {
+	case SelectUpstream:
+		return []Cluster{outputs.Upstream()}, nil
+	case SelectDownstream:
+		return outputs.Downstream(), nil
+	case SelectTester:
+		return []Cluster{outputs.Tester()}, nil
+	case SelectAll:
+		return append([]Cluster{outputs.Upstream()}, outputs.Downstream()...), nil
+	}
+	c, ok := outputs.Clusters[selector]
+	if !ok {
+		return nil, fmt.Errorf("No cluster '%s' in the deployment", selector)
+	}
+	return []Cluster{c}, nil
+}
+
+func renderTemplates(values map[string]string, ctx SuiteContext) (map[string]string, error) {
+	result := map[string]string{}
+	for k, v := range values {
+		t, err := template.New(k).Option("missingkey=error").Parse(v)
+		if err != nil {
+			return nil, err
+		}
+		var b strings.Builder
+		if err := t.Execute(&b, ctx); err != nil {
+			return nil, err
+		}
+		result[k] = b.String()
+	}
+	return result, nil
+}
@@ -0,0 +1,104 @@
+package deploy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadDefaultSuite(t *testing.T) {
+	t.Setenv("SOIL_HOME", t.TempDir())
+	s, err := LoadSuite("")
+	assert.NoError(t, err)
+	assert.Equal(t, DEFAULT_SUITE, s.Name)
+	assert.Empty(t, s.File)
+	assert.Len(t, s.Tests, 3)
+	assert.Equal(t, SelectDownstream, s.Tests[0].Clusters)
+
+	_, err = LoadSuite("missing")
+	assert.ErrorContains(t, err, "Unknown test suite 'missing'")
+}
+
+func TestSuiteWithVars(t *testing.T) {
+	t.Setenv("SOIL_HOME", t.TempDir())
+	s, err := LoadSuite(DEFAULT_SUITE)
+	assert.NoError(t, err)
+
+	vars, err := s.WithVars(map[string]string{"CONFIG_MAP_COUNT": "5000"})
+	assert.NoError(t, err)
+	assert.Equal(t, "5000", vars["CONFIG_MAP_COUNT"])
+	assert.Equal(t, "1000", vars["SECRET_COUNT"])
+	assert.Equal(t, "1000", s.Vars["CONFIG_MAP_COUNT"])
+
+	_, err = s.WithVars(map[string]string{"CONFIG_MAPS": "5000"})
+	assert.ErrorContains(t, err, "has no vars: CONFIG_MAPS")
+}
+
+func TestLoadSuiteFromHome(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("SOIL_HOME", home)
+	assert.NoError(t, os.MkdirAll(filepath.Join(home, "suites"), 0755))
+	smoke := `
+name: smoke
+tests:
+  - name: projects
+    script: k6/create_projects.js
+    clusters: all
+    env:
+      BASE_URL: "https://{{ .Cluster.PrivateName }}"
+`
+	path := filepath.Join(home, "suites", "smoke.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(smoke), 0644))
+	s, err := LoadSuite("smoke")
+	assert.NoError(t, err)
+	assert.Equal(t, path, s.File)
+	assert.Equal(t, SelectAll, s.Tests[0].Clusters)
+
+	invalid := "tests:\n  - name: broken\n    env:\n      A: \"{{ .Cluster\"\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(home, "invalid.yaml"), []byte(invalid), 0644))
+	_, err = LoadSuite(filepath.Join(home, "invalid.yaml"))
+	assert.ErrorContains(t, err, "test broken: script is required")
+	assert.ErrorContains(t, err, "test broken: clusters is required")
+	assert.ErrorContains(t, err, "test broken: env:")
+}
+
+func TestSelectClusters(t *testing.T) {
+	outputs := &TerraformOutputs{Clusters: map[string]Cluster{
+		"upstream":     {Name: "upstream"},
+		"tester":       {Name: "tester"},
+		"downstream-1": {Name: "downstream-1"},
+		"downstream-0": {Name: "downstream-0"},
+	}}
+	names := func(selector string) []string {
+		clusters, err := selectClusters(outputs, selector)
+		assert.NoError(t, err)
+		result := []string{}
+		for _, c := range clusters {
+			result = append(result, c.Name)
+		}
+		return result
+	}
+	assert.Equal(t, []string{"upstream"}, names(SelectUpstream))
+	assert.Equal(t, []string{"downstream-0", "downstream-1"}, names(SelectDownstream))
+	assert.Equal(t, []string{"upstream", "downstream-0", "downstream-1"}, names(SelectAll))
+	assert.Equal(t, []string{"downstream-1"}, names("downstream-1"))
+	_, err := selectClusters(outputs, "downstream-2")
+	assert.Error(t, err)
+}
+
+func TestScalabilityDeploymentTestSuiteVars(t *testing.T) {
+	d, f := newTestDeployment(t)
+	SuiteVars = map[string]string{"CONFIG_MAP_COUNT": "5000"}
+	defer func() { SuiteVars = nil }()
+	assert.NoError(t, d.Test(context.Background()))
+	assert.Len(t, f.Matching(`^kubectl run k6 `), 3)
+	assert.Len(t, f.Matching(`^kubectl run k6 .*CONFIG_MAP_COUNT=5000`), 1)
+	assert.Len(t, f.Matching(`^kubectl run k6 .*cluster=upstream`), 2)
+
+	SuiteName = "missing"
+	defer func() { SuiteName = "" }()
+	assert.ErrorContains(t, d.Test(context.Background()), "Unknown test suite 'missing'")
+}
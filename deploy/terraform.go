@@ -0,0 +1,176 @@
+package deploy
+
+import (
+	"encoding/json"
+	"fmt"
+	"soil/util"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Cluster is a cluster created by terraform, as found in the "clusters"
+// output of scalability-tests configurations.
+type Cluster struct {
+	Name               string            `json:"name"`
+	LocalName          string            `json:"local_name"`
+	PrivateName        string            `json:"private_name"`
+	Kubeconfig         string            `json:"kubeconfig"`
+	Context            string            `json:"context"`
+	LocalHttpPort      int               `json:"local_http_port"`
+	LocalHttpsPort     int               `json:"local_https_port"`
+	NodeAccessCommands map[string]string `json:"node_access_commands"`
+}
+
+// Access returns details needed by kubectl and helm to reach the cluster.
+func (c Cluster) Access() util.ClusterAccess {
+	return util.ClusterAccess{Kubeconfig: c.Kubeconfig, Context: c.Context}
+}
+
+// LocalUrl returns https url of the cluster reachable from the local host.
+func (c Cluster) LocalUrl() string {
+	return fmt.Sprintf("https://%s:%d", c.LocalName, c.LocalHttpsPort)
+}
+
+const GRAFANA_DASHBOARD_PATH = "/grafana/d/a1508c35-b2e6-47f4-94ab-fec400d1c243/test-results" +
+	"?orgId=1&refresh=5s&from=now-30m&to=now"
+
+// GrafanaUrl returns url of the test results dashboard served by the tester cluster.
+func (c Cluster) GrafanaUrl() string {
+	return fmt.Sprintf("http://%s:%d%s", c.LocalName, c.LocalHttpPort, GRAFANA_DASHBOARD_PATH)
+}
+
+// TerraformOutputs is a model of terraform outputs consumed by deployments.
+type TerraformOutputs struct {
+	Clusters map[string]Cluster
+}
+
+func (o TerraformOutputs) Tester() Cluster {
+	return o.Clusters["tester"]
+}
+
+func (o TerraformOutputs) Upstream() Cluster {
+	return o.Clusters["upstream"]
+}
+
+// Downstream returns downstream clusters sorted by name.
+func (o TerraformOutputs) Downstream() []Cluster {
+	downstream := []Cluster{}
+	for name, c := range o.Clusters {
+		if strings.HasPrefix(name, "downstream") {
+			downstream = append(downstream, c)
+		}
+	}
+	sort.Slice(downstream, func(i, j int) bool {
+		return downstream[i].Name < downstream[j].Name
+	})
+	return downstream
+}
+
+// TerraformOutputError reports an invalid terraform output naming the field.
+type TerraformOutputError struct {
+	Cluster string
+	Field   string
+	Reason  string
+}
+
+func (e *TerraformOutputError) Error() string {
+	if e.Cluster == "" {
+		return fmt.Sprintf("Invalid terraform output '%s': %s", e.Field, e.Reason)
+	}
+	return fmt.Sprintf("Invalid terraform output of cluster '%s', field '%s': %s",
+		e.Cluster, e.Field, e.Reason)
+}
+
+// ParseTerraformOutputs parses output of `terraform output -json`.
+func ParseTerraformOutputs(data []byte) (*TerraformOutputs, error) {
+	var status map[string]any
+	if err := json.Unmarshal(data, &status); err != nil {
+		return nil, fmt.Errorf("Invalid terraform output: %w", err)
+	}
+	return NewTerraformOutputs(status)
+}
+
+// NewTerraformOutputs validates and converts decoded terraform outputs.
+func NewTerraformOutputs(status map[string]any) (*TerraformOutputs, error) {
+	output, ok := status["clusters"].(map[string]any)
+	if !ok {
+		return nil, &TerraformOutputError{Field: "clusters", Reason: "missing"}
+	}
+	value, ok := output["value"].(map[string]any)
+	if !ok {
+		return nil, &TerraformOutputError{Field: "clusters.value", Reason: "missing"}
+	}
+	o := &TerraformOutputs{Clusters: map[string]Cluster{}}
+	for name, v := range value {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil, &TerraformOutputError{Cluster: name, Reason: "not an object"}
+		}
+		c, err := parseCluster(name, m)
+		if err != nil {
+			return nil, err
+		}
+		o.Clusters[name] = c
+	}
+	for _, name := range []string{"tester", "upstream"} {
+		if _, ok := o.Clusters[name]; !ok {
+			return nil, &TerraformOutputError{Field: "clusters.value." + name, Reason: "missing"}
+		}
+	}
+	return o, nil
+}
+
+func parseCluster(name string, m map[string]any) (c Cluster, err error) {
+	c.Name = name
+	fields := []struct {
+		name  string
+		value *string
+	}{
+		{"local_name", &c.LocalName},
+		{"private_name", &c.PrivateName},
+		{"kubeconfig", &c.Kubeconfig},
+		{"context", &c.Context},
+	}
+	for _, f := range fields {
+		s, ok := m[f.name].(string)
+		if !ok {
+			return c, missingField(name, f.name, m[f.name])
+		}
+		*f.value = s
+	}
+	ports := []struct {
+		name  string
+		value *int
+	}{
+		{"local_http_port", &c.LocalHttpPort},
+		{"local_https_port", &c.LocalHttpsPort},
+	}
+	for _, p := range ports {
+		switch v := m[p.name].(type) {
+		case float64:
+			*p.value = int(v)
+		case string:
+			if *p.value, err = strconv.Atoi(v); err != nil {
+				return c, &TerraformOutputError{Cluster: name, Field: p.name, Reason: "not a port number"}
+			}
+		default:
+			return c, missingField(name, p.name, m[p.name])
+		}
+	}
+	c.NodeAccessCommands = map[string]string{}
+	if commands, ok := m["node_access_commands"].(map[string]any); ok {
+		for node, command := range commands {
+			c.NodeAccessCommands[node] = fmt.Sprintf("%v", command)
+		}
+	}
+	return c, nil
+}
+
+func missingField(cluster string, field string, value any) error {
+	if value == nil {
+		return &TerraformOutputError{Cluster: cluster, Field: field, Reason: "missing"}
+	}
+	return &TerraformOutputError{Cluster: cluster, Field: field,
+		Reason: fmt.Sprintf("unexpected value %v", value)}
+}
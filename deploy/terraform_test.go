@@ -0,0 +1,37 @@
+package deploy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTerraformOutputs(t *testing.T) {
+	o, err := ParseTerraformOutputs([]byte(testTerraformOutput))
+	assert.NoError(t, err)
+	assert.Equal(t, "upstream.private", o.Upstream().PrivateName)
+	assert.Equal(t, 8444, o.Upstream().LocalHttpsPort)
+	assert.Equal(t, "https://upstream.local.gd:8444", o.Upstream().LocalUrl())
+	assert.Equal(t, 8080, o.Tester().LocalHttpPort)
+	assert.Len(t, o.Downstream(), 1)
+	assert.Equal(t, "downstream", o.Downstream()[0].Name)
+	assert.Equal(t, "k3d-downstream", o.Downstream()[0].Access().Context)
+}
+
+func TestParseTerraformOutputsMissingField(t *testing.T) {
+	_, err := ParseTerraformOutputs([]byte(`{"clusters": {"value": {
+		"tester": {"local_name": "tester", "private_name": "tester", "context": "tester",
+			"local_http_port": 80, "local_https_port": 443}}}}`))
+	var outputErr *TerraformOutputError
+	assert.ErrorAs(t, err, &outputErr)
+	assert.Equal(t, "tester", outputErr.Cluster)
+	assert.Equal(t, "kubeconfig", outputErr.Field)
+	assert.Contains(t, err.Error(), "'kubeconfig'")
+}
+
+func TestParseTerraformOutputsMissingCluster(t *testing.T) {
+	_, err := ParseTerraformOutputs([]byte(`{"clusters": {"value": {}}}`))
+	assert.ErrorContains(t, err, "clusters.value.tester")
+	_, err = ParseTerraformOutputs([]byte(`{}`))
+	assert.ErrorContains(t, err, "'clusters'")
+}
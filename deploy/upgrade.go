@@ -0,0 +1,206 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const StateUpgrading = "upgrading"
+
+// Results of history entries
+const (
+	ResultSucceeded   = "succeeded"
+	ResultFailed      = "failed"
+	ResultInterrupted = "interrupted"
+)
+
+// HistoryEntry records a change of a deployed environment, e.g. an upgrade.
+type HistoryEntry struct {
+	Action      string    `json:"action" yaml:"action"`
+	Chart       string    `json:"chart,omitempty" yaml:"chart,omitempty"`
+	From        string    `json:"from,omitempty" yaml:"from,omitempty"`
+	To          string    `json:"to,omitempty" yaml:"to,omitempty"`
+	StartedAt   time.Time `json:"started_at" yaml:"started_at"`
+	FinishedAt  time.Time `json:"finished_at,omitempty" yaml:"finished_at,omitempty"`
+	Result      string    `json:"result,omitempty" yaml:"result,omitempty"`
+	Error       string    `json:"error,omitempty" yaml:"error,omitempty"`
+	TestsBefore string    `json:"tests_before,omitempty" yaml:"tests_before,omitempty"`
+	TestsAfter  string    `json:"tests_after,omitempty" yaml:"tests_after,omitempty"`
+}
+
+func (h HistoryEntry) String() string {
+	s := fmt.Sprintf("%s %s", formatTime(h.StartedAt), h.Action)
+	if h.Chart != "" {
+		s += fmt.Sprintf(" %s %s -> %s", h.Chart, h.From, h.To)
+	}
+	if h.Result != "" {
+		s += ": " + h.Result
+	}
+	if h.TestsBefore != "" || h.TestsAfter != "" {
+		s += fmt.Sprintf(" (tests before: %s, after: %s)", dashIfEmpty(h.TestsBefore), dashIfEmpty(h.TestsAfter))
+	}
+	return s
+}
+
+func dashIfEmpty(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func testResult(err error) string {
+	if err != nil {
+		return ResultFailed
+	}
+	return ResultSucceeded
+}
+
+// UpgradeOptions select what `so upgrade` changes.
+type UpgradeOptions struct {
+	RancherVersion string
+	// RancherChartURL replaces the rancher chart URL, a URL set at deploy time is kept otherwise
+	RancherChartURL string
+	// RunTests runs tests before and after the upgrade
+	RunTests bool
+}
+
+/**
+ * Upgrade: upgrade rancher of the deployment in place.
+ *
+ * The rancher release is upgraded with the chart and image of the new version,
+ * then it waits for rancher and all clusters to become ready again.
+ * The upgrade is recorded in the deployment history.
+ *
+ * With RunTests, Reports of tests before and after the upgrade are suffixed
+ * with -before and -after, results after the upgrade are compared with Baseline.
+ */
+func (d ScalabilityDeployment) Upgrade(ctx context.Context, o UpgradeOptions) error {
+	version := strings.TrimPrefix(o.RancherVersion, "v")
+	if !versionPattern.MatchString(version) {
+		return fmt.Errorf("Invalid rancher version '%s'", o.RancherVersion)
+	}
+	if !contains(d.CompletedPhases, PhaseRancher) {
+		return fmt.Errorf("Rancher is not installed in deployment '%s' yet", d.Name)
+	}
+	from := d.Charts["rancher"].Version
+	if from == version {
+		fmt.Printf("Rancher of %s is already %s\n", d.Name, version)
+		return nil
+	}
+	fmt.Printf("Upgrading rancher of %s from %s to %s...\n", d.Name, from, version)
+
+	entry := HistoryEntry{Action: "upgrade", Chart: "rancher", From: from, To: version, StartedAt: time.Now().UTC()}
+	state := d.State
+	finish := func(err error) error {
+		entry.FinishedAt = time.Now().UTC()
+		started := d.State == StateUpgrading
+		switch {
+		case err == nil:
+			entry.Result = ResultSucceeded
+			d.State = state
+		case ctx.Err() != nil:
+			entry.Result = ResultInterrupted
+			d.State = StateInterrupted
+		default:
+			entry.Result = ResultFailed
+			d.State = StateFailed
+		}
+		if !started {
+			// the environment is not changed yet
+			d.State = state
+		}
+		if err != nil {
+			entry.Error = err.Error()
+		}
+		d.History[len(d.History)-1] = entry
+		if serr := d.saveStatus(); serr != nil {
+			if err == nil {
+				return serr
+			}
+			log.Printf("*** %v", serr)
+		}
+		return err
+	}
+
+	if o.RunTests {
+		err := d.test(ctx, suffixReports(Reports, "before"), "")
+		entry.TestsBefore = testResult(err)
+		if err != nil {
+			d.History = append(d.History, entry)
+			return finish(fmt.Errorf("Tests before upgrade failed: %w", err))
+		}
+	}
+
+	d.State = StateUpgrading
+	d.History = append(d.History, entry)
+	// keep installed monitoring charts, they are derived from rancher line
+	charts := map[string]Chart{}
+	for name, c := range d.Charts {
+		if c.URL == "" {
+			c.URL = d.chartURL(name)
+		}
+		charts[name] = c
+	}
+	if line := rancherLine(version); line != rancherLine(from) && d.Charts["rancher-monitoring"].Version != "" {
+		log.Printf("rancher-monitoring stays at %s of rancher %s line, it is not upgraded to the %s line",
+			d.Charts["rancher-monitoring"].Version, rancherLine(from), line)
+	}
+	rancher := d.Charts["rancher"]
+	rancher.Version = version
+	if o.RancherChartURL != "" {
+		rancher.URL = o.RancherChartURL
+	} else if rancher.URL != "" {
+		log.Printf("Keeping rancher chart URL %s", rancher.URL)
+	}
+	charts["rancher"] = rancher
+	d.Charts = charts
+	if err := d.saveStatus(); err != nil {
+		return err
+	}
+
+	if err := finish(d.upgradeRancher(ctx)); err != nil || !o.RunTests {
+		return err
+	}
+	err := d.test(ctx, suffixReports(Reports, "after"), Baseline)
+	entry.TestsAfter = testResult(err)
+	d.History[len(d.History)-1] = entry
+	if serr := d.saveStatus(); serr != nil {
+		log.Printf("*** %v", serr)
+	}
+	if err != nil {
+		return fmt.Errorf("Tests after upgrade failed: %w", err)
+	}
+	return nil
+}
+
+func (d ScalabilityDeployment) upgradeRancher(ctx context.Context) error {
+	outputs, err := d.getOutputs(ctx)
+	if err != nil {
+		return err
+	}
+	upstream := outputs.Upstream()
+	if err := d.installRancher(ctx); err != nil {
+		return err
+	}
+	_, err = d.run().Exec(ctx, "kubectl", "rollout", "status", "deployment/rancher", "--namespace", "cattle-system",
+		"--timeout="+WaitTimeout.String(),
+		"--kubeconfig="+upstream.Kubeconfig,
+		"--context="+upstream.Context,
+	)
+	if err != nil {
+		return stepError("kubectl rollout status deployment/rancher", err)
+	}
+	if err := d.waitRancher(ctx, upstream); err != nil {
+		return err
+	}
+	return d.waitClusters(ctx, upstream, len(outputs.Downstream()) > 0)
+}
+
+func (d CommonDeployment) Upgrade(ctx context.Context, o UpgradeOptions) error {
+	return fmt.Errorf("Upgrade is not implemented for deployment: %s", reflect.TypeOf(d))
+}
@@ -0,0 +1,115 @@
+package deploy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"soil/util"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newDeployedTestDeployment returns deployed deployment as loaded from status
+// with a new fake executor.
+func newDeployedTestDeployment(t *testing.T) (*ScalabilityDeployment, *util.FakeExecutor) {
+	d, _ := newTestDeployment(t)
+	_, err := d.Make(context.Background())
+	assert.NoError(t, err)
+	s, err := LookupDeployment("test")
+	assert.NoError(t, err)
+	f := newTestExecutor()
+	s.(*ScalabilityDeployment).Executor = f
+	return s.(*ScalabilityDeployment), f
+}
+
+func TestScalabilityDeploymentUpgrade(t *testing.T) {
+	s, f := newDeployedTestDeployment(t)
+	assert.NoError(t, s.Upgrade(context.Background(), UpgradeOptions{RancherVersion: "v2.8.2", RunTests: true}))
+
+	assert.Len(t, f.Matching(`^helm .* rancher https://releases.rancher.com/.*/rancher-2.8.2.tgz .*rancherImageTag="v2.8.2"`), 1)
+	assert.Len(t, f.Matching(`^kubectl rollout status deployment/rancher`), 1)
+	assert.Len(t, f.Matching(`^kubectl wait clusters.management.cattle.io --all`), 1)
+	assert.Len(t, f.Matching(`^kubectl run k6 `), 6)
+
+	u, err := LookupDeployment("test")
+	assert.NoError(t, err)
+	upgraded := u.(*ScalabilityDeployment)
+	assert.Equal(t, StateDeployed, upgraded.State)
+	assert.Equal(t, "2.8.2", upgraded.Charts["rancher"].Version)
+	// monitoring charts keep the installed version
+	assert.Equal(t, s.chartURL("rancher-monitoring"), upgraded.chartURL("rancher-monitoring"))
+	assert.Len(t, upgraded.History, 1)
+	h := upgraded.History[0]
+	assert.Equal(t, "2.7.6", h.From)
+	assert.Equal(t, "2.8.2", h.To)
+	assert.Equal(t, ResultSucceeded, h.Result)
+	assert.Equal(t, ResultSucceeded, h.TestsBefore)
+	assert.Equal(t, ResultSucceeded, h.TestsAfter)
+}
+
+func TestScalabilityDeploymentUpgradeReports(t *testing.T) {
+	s, _ := newDeployedTestDeployment(t)
+	s.Executor = newTestExecutor().On(`logs k6`, testK6Summary(100, 0), 0)
+	dir := t.TempDir()
+	Reports = map[string]string{"junit": filepath.Join(dir, "out.xml"), "md": filepath.Join(dir, "report")}
+	// there is no run to compare tests before the upgrade with
+	Baseline = LATEST_RUN
+	defer func() {
+		Reports = nil
+		Baseline = ""
+	}()
+	assert.NoError(t, s.Upgrade(context.Background(), UpgradeOptions{RancherVersion: "2.8.2", RunTests: true}))
+
+	for _, file := range []string{"out-before.xml", "out-after.xml", "report-before", "report-after"} {
+		assert.FileExists(t, filepath.Join(dir, file))
+	}
+	assert.NoFileExists(t, filepath.Join(dir, "out.xml"))
+	runs, err := ListRuns(s.Name)
+	assert.NoError(t, err)
+	assert.Len(t, runs, 2)
+	assert.Equal(t, "2.7.6", runs[0].RancherVersion)
+	assert.Equal(t, "2.8.2", runs[1].RancherVersion)
+	data, err := os.ReadFile(filepath.Join(dir, "report-after"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "# Test run "+runs[1].ID)
+}
+
+func TestScalabilityDeploymentUpgradeFailed(t *testing.T) {
+	s, f := newDeployedTestDeployment(t)
+	f.On(`^kubectl rollout status`, "", 1)
+	err := s.Upgrade(context.Background(), UpgradeOptions{RancherVersion: "2.8.2"})
+	var stepErr *StepError
+	assert.ErrorAs(t, err, &stepErr)
+
+	u, err := LookupDeployment("test")
+	assert.NoError(t, err)
+	upgraded := u.(*ScalabilityDeployment)
+	assert.Equal(t, StateFailed, upgraded.State)
+	assert.Equal(t, ResultFailed, upgraded.History[0].Result)
+	assert.Empty(t, upgraded.History[0].TestsBefore)
+}
+
+func TestScalabilityDeploymentUpgradeNotDeployed(t *testing.T) {
+	d, _ := newTestDeployment(t)
+	assert.Error(t, d.Upgrade(context.Background(), UpgradeOptions{RancherVersion: "2.8.2"}))
+	assert.Error(t, d.Upgrade(context.Background(), UpgradeOptions{RancherVersion: "latest"}))
+}
+
+func TestScalabilityDeploymentUpgradeChartURL(t *testing.T) {
+	s, f := newDeployedTestDeployment(t)
+	rancher := s.Charts["rancher"]
+	rancher.URL = "https://example.com/rancher.tgz"
+	s.Charts["rancher"] = rancher
+	assert.NoError(t, s.Upgrade(context.Background(), UpgradeOptions{RancherVersion: "2.8.2"}))
+	assert.Len(t, f.Matching(`^helm .* rancher https://example.com/rancher.tgz .*rancherImageTag="v2.8.2"`), 1)
+
+	s, f = newDeployedTestDeployment(t)
+	assert.NoError(t, s.Upgrade(context.Background(),
+		UpgradeOptions{RancherVersion: "2.8.2", RancherChartURL: "https://example.com/rancher-2.8.2.tgz"}))
+	assert.Len(t, f.Matching(`^helm .* rancher https://example.com/rancher-2.8.2.tgz `), 1)
+	u, err := LookupDeployment("test")
+	assert.NoError(t, err)
+	assert.Equal(t, Chart{Version: "2.8.2", URL: "https://example.com/rancher-2.8.2.tgz"},
+		u.(*ScalabilityDeployment).Charts["rancher"])
+}
@@ -0,0 +1,462 @@
+package util
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// Executor runs external commands on behalf of the execution helpers.
+type Executor interface {
+	// Run executes the command, logging and capturing its output as set by c.
+	Run(ctx context.Context, c Ctx, args ...string) (string, error)
+	// RunTty executes the command attached to the terminal.
+	RunTty(ctx context.Context, args ...string) error
+	// Start starts the command in background, stop terminates it.
+	Start(ctx context.Context, args ...string) (stop func(), err error)
+}
+
+// OsExecutor runs commands as operating system processes.
+type OsExecutor struct{}
+
+func (OsExecutor) Run(ctx context.Context, c Ctx, args ...string) (string, error) {
+	return c.execLogging(ctx, args...)
+}
+
+func (OsExecutor) RunTty(ctx context.Context, args ...string) error {
+	// keep the terminal process group, so the command is able to read input,
+	// Ctrl-C is delivered by the terminal to the command as well
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.WaitDelay = TERMINATION_GRACE
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err := cmd.Run()
+	if err != nil {
+		log.Printf("*** Command returns: %v", err)
+	}
+	return err
+}
+
+func (OsExecutor) Start(ctx context.Context, args ...string) (func(), error) {
+	ctx, cancel := context.WithCancel(ctx)
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	group := setProcessGroup(cmd)
+	cmd.WaitDelay = TERMINATION_GRACE
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return nil, err
+	}
+	return func() {
+		cancel()
+		cmd.Wait()
+		group.exited()
+	}, nil
+}
+
+// DryRunExecutor prints commands to stdout instead of running them.
+type DryRunExecutor struct{}
+
+func (DryRunExecutor) Run(ctx context.Context, c Ctx, args ...string) (string, error) {
+	fmt.Println(dryRunCommand(args))
+	return "", nil
+}
+
+func (DryRunExecutor) RunTty(ctx context.Context, args ...string) error {
+	fmt.Println(dryRunCommand(args))
+	return nil
+}
+
+func (DryRunExecutor) Start(ctx context.Context, args ...string) (func(), error) {
+	fmt.Println(dryRunCommand(args) + " &")
+	return func() {}, nil
+}
+
+// DefaultExecutor returns executor used when none is given explicitly.
+func DefaultExecutor() Executor {
+	if DryRun {
+		return DryRunExecutor{}
+	}
+	return OsExecutor{}
+}
+
+// ClusterAccess points kubectl and helm to a kubernetes cluster.
+type ClusterAccess struct {
+	Kubeconfig string
+	Context    string
+}
+
+// Runner binds the execution helpers to an Executor.
+type Runner struct {
+	Executor Executor
+}
+
+// NewRunner returns a Runner for the executor, or the default one if nil.
+func NewRunner(e Executor) Runner {
+	if e == nil {
+		e = DefaultExecutor()
+	}
+	return Runner{Executor: e}
+}
+
+func (r Runner) run(ctx context.Context, c *Ctx, cmd string) (string, error) {
+	return r.Executor.Run(ctx, *c, "bash", "-c", cmd)
+}
+
+func (r Runner) Exec(ctx context.Context, args ...string) (string, error) {
+	cmdStr := strings.Join(args, " ")
+	log.Printf("*** Running command: %s", cmdStr)
+	run := NewRun()
+	run.Capture.Stdout = false
+	return r.run(ctx, run, cmdStr)
+}
+
+func (r Runner) ExecTty(ctx context.Context, args ...string) error {
+	cmdStr := strings.Join(args, " ")
+	log.Printf("*** Running command: %s", cmdStr)
+	return r.Executor.RunTty(ctx, "bash", "-c", cmdStr)
+}
+
+func (r Runner) ExecOutput(ctx context.Context, args ...string) (string, error) {
+	cmdStr := strings.Join(args, " ")
+	log.Printf("Running command: %s", cmdStr)
+	run := NewRun()
+	return r.run(ctx, run, cmdStr)
+}
+
+func (r Runner) ExecUnmarshalJson(ctx context.Context, args ...string) (map[string]any, error) {
+	cmdStr := strings.Join(args, " ")
+	log.Printf("Running command: %s", cmdStr)
+	run := NewRun()
+	output, err := r.run(ctx, run, cmdStr)
+	var result map[string]any
+	json.Unmarshal([]byte(output), &result)
+	return result, err
+}
+
+func (r Runner) ExecQuietUnmarshalJson(ctx context.Context, args ...string) (map[string]any, error) {
+	cmdStr := strings.Join(args, " ")
+	log.Printf("Running command: %s", cmdStr)
+	run := NewRun()
+	run.Logging.Stdout = false
+	output, err := r.run(ctx, run, cmdStr)
+	var result map[string]any
+	json.Unmarshal([]byte(output), &result)
+	return result, err
+}
+
+func (r Runner) Shell(ctx context.Context, cmd string) (string, error) {
+	run := NewRun()
+	run.Capture.Stdout = false
+	log.Printf("Running command: %s", cmd)
+	return r.run(ctx, run, cmd)
+}
+
+func (r Runner) ShellUnmarshalJson(ctx context.Context, cmd string) (map[string]any, error) {
+	log.Printf("Running command: %s", cmd)
+	run := NewRun()
+	output, err := r.run(ctx, run, cmd)
+	var result map[string]any
+	json.Unmarshal([]byte(output), &result)
+	return result, err
+}
+
+func (r Runner) ShellQuietUnmarshalJson(ctx context.Context, cmd string) (map[string]any, error) {
+	run := NewRun()
+	run.Logging.Stderr = false
+	run.Logging.Stdout = false
+	output, err := r.run(ctx, run, cmd)
+	var result map[string]any
+	json.Unmarshal([]byte(output), &result)
+	return result, err
+}
+
+func (r Runner) ShellCombined(ctx context.Context, cmd string) (string, error) {
+	run := NewRun()
+	run.Capture.Stderr = true
+	log.Printf("Running command: %s", cmd)
+	return r.run(ctx, run, cmd)
+}
+
+func (r Runner) ShellOutput(ctx context.Context, cmd string) (string, error) {
+	run := NewRun()
+	return r.run(ctx, run, cmd)
+}
+
+func (r Runner) ShellQuietOutput(ctx context.Context, cmd string) (string, error) {
+	run := NewRun()
+	run.Logging.Stdout = false
+	return r.run(ctx, run, cmd)
+}
+
+func (r Runner) HelmInstall(ctx context.Context, name string, chart string, cluster ClusterAccess, namespace string, values map[string]any) error {
+	//log.Printf("json %#v", values)
+	args := []string{
+		"helm",
+		"--kubeconfig=" + cluster.Kubeconfig,
+		"--kube-context=" + cluster.Context,
+		"upgrade", "--install",
+		"--namespace=" + namespace,
+		name, chart,
+		"--create-namespace",
+	}
+	if values != nil {
+		args = append(args, "--set-json='"+HelmJson(values)+"'")
+	}
+	_, err := r.Exec(ctx, args...)
+	return err
+}
+
+func (r Runner) KubeCtl(ctx context.Context, cluster ClusterAccess, args ...string) error {
+	a := []string{
+		"kubectl",
+	}
+	a = append(a, args...)
+	a = append(a,
+		"--kubeconfig="+cluster.Kubeconfig,
+		"--context="+cluster.Context,
+	)
+	_, err := r.Exec(ctx, a...)
+	return err
+}
+
+// KubeCtlOutput runs kubectl returning its output, which is not logged.
+func (r Runner) KubeCtlOutput(ctx context.Context, cluster ClusterAccess, args ...string) (string, error) {
+	a := []string{
+		"kubectl",
+	}
+	a = append(a, args...)
+	a = append(a,
+		"--kubeconfig="+cluster.Kubeconfig,
+		"--context="+cluster.Context,
+	)
+	cmdStr := strings.Join(a, " ")
+	log.Printf("Running command: %s", cmdStr)
+	run := NewRun()
+	run.Logging.Stdout = false
+	return r.run(ctx, run, cmdStr)
+}
+
+/**
+ * PortForward forwards a free local port to the port of the resource,
+ * e.g. svc/mimir, until stop is called.
+ *
+ * The port may not accept connections right after return, clients are
+ * expected to retry.
+ */
+func (r Runner) PortForward(ctx context.Context, cluster ClusterAccess, namespace string, resource string, port int) (int, func(), error) {
+	localPort, err := FreePort()
+	if err != nil {
+		return 0, nil, err
+	}
+	args := []string{"kubectl", "port-forward", "--namespace=" + namespace, resource,
+		fmt.Sprintf("%d:%d", localPort, port),
+		"--kubeconfig=" + cluster.Kubeconfig,
+		"--context=" + cluster.Context,
+	}
+	log.Printf("*** Starting command: %s", strings.Join(args, " "))
+	stop, err := r.Executor.Start(ctx, args...)
+	if err != nil {
+		return 0, nil, err
+	}
+	return localPort, stop, nil
+}
+
+func (r Runner) KubeCtlTty(ctx context.Context, cluster ClusterAccess, args ...string) error {
+	a := []string{
+		"kubectl",
+	}
+	a = append(a, args...)
+	a = append(a,
+		"--kubeconfig="+cluster.Kubeconfig,
+		"--context="+cluster.Context,
+	)
+	return r.ExecTty(ctx, a...)
+}
+
+/**
+ * Runs a k6 script from inside the specified k8s cluster via kubectl run.
+ * Specify envs, tags, and a test file from the k6/ dir (which will be transferred via ConfigMaps).
+ * Set record = true for result metrics to be sent to Mimir, which is expected to be running in the same cluster.
+ *
+ * If the test script exercises the Kubernetes API, specify a KUBECONFIG env, the corresponding file will be transferred
+ * to the cluster via a Secret.
+ *
+ * The end-of-test summary is read from the logs of the k6 pod, it is returned
+ * along with the error if k6 fails, e.g. when thresholds are not met.
+ */
+func (r Runner) K6Run(ctx context.Context, cluster ClusterAccess, envs map[string]string, tags map[string]string, test string, record bool, tty bool) (*K6Summary, error) {
+	args, kubeconfig, err := r.k6Prepare(ctx, cluster, envs, tags, test)
+	if err != nil {
+		return nil, err
+	}
+	return r.k6Pod(ctx, cluster, "k6", args, kubeconfig, record, tty)
+}
+
+/**
+ * K6RunPods runs the k6 script as K6Run, split to execution segments of
+ * the given number of pods running in parallel.
+ *
+ * It waits for all pods, the error lists every failed pod. The summary
+ * merges summaries of all pods, see MergeK6Summaries.
+ */
+func (r Runner) K6RunPods(ctx context.Context, cluster ClusterAccess, envs map[string]string, tags map[string]string, test string, record bool, pods int) (*K6Summary, error) {
+	if pods <= 1 {
+		return r.K6Run(ctx, cluster, envs, tags, test, record, true)
+	}
+	args, kubeconfig, err := r.k6Prepare(ctx, cluster, envs, tags, test)
+	if err != nil {
+		return nil, err
+	}
+	sequence := []string{"0"}
+	for i := 1; i < pods; i++ {
+		sequence = append(sequence, fmt.Sprintf("%d/%d", i, pods))
+	}
+	sequence = append(sequence, "1")
+
+	summaries := make([]*K6Summary, pods)
+	errs := make([]error, pods)
+	var wg sync.WaitGroup
+	for i := 0; i < pods; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprintf("k6-%d", i)
+			segmentArgs := append([]string{
+				"--execution-segment=" + sequence[i] + ":" + sequence[i+1],
+				"--execution-segment-sequence=" + strings.Join(sequence, ","),
+				"--tag", fmt.Sprintf("segment=%d", i),
+			}, args...)
+			summaries[i], errs[i] = r.k6Pod(ctx, cluster, name, segmentArgs, kubeconfig, record, false)
+			if errs[i] != nil {
+				errs[i] = fmt.Errorf("pod %s: %w", name, errs[i])
+			}
+		}(i)
+	}
+	wg.Wait()
+	return MergeK6Summaries(summaries), errors.Join(errs...)
+}
+
+// k6Prepare returns k6 run args for the envs, tags and the test, the kubeconfig
+// given by KUBECONFIG env is stored in a Secret.
+func (r Runner) k6Prepare(ctx context.Context, cluster ClusterAccess, envs map[string]string, tags map[string]string, test string) ([]string, string, error) {
+	kubeconfig, ok := envs["KUBECONFIG"]
+	if ok {
+		err := r.KubeCtl(ctx, cluster, "--namespace=tester", "delete", "secret", "kube", "--ignore-not-found")
+		if err != nil {
+			return nil, "", err
+		}
+		err = r.KubeCtl(ctx, cluster, "--namespace=tester", "create", "secret", "generic", "kube",
+			"--from-file=config="+kubeconfig)
+		if err != nil {
+			return nil, "", err
+		}
+		envs["KUBECONFIG"] = "/kube/config"
+	}
+	log.Printf("k6 env=%#v", envs)
+	args := []string{}
+	for k, v := range envs {
+		args = append(args, "-e", fmt.Sprintf("%s=%s", k, v))
+	}
+	if tags != nil {
+		for k, v := range tags {
+			args = append(args, "--tag", fmt.Sprintf("%s=%s", k, v))
+		}
+	}
+	args = append(args, test)
+	return args, kubeconfig, nil
+}
+
+// k6Pod runs k6 with the args in the pod of the name and reads the summary from its logs.
+func (r Runner) k6Pod(ctx context.Context, cluster ClusterAccess, name string, args []string, kubeconfig string, record bool, tty bool) (*K6Summary, error) {
+	containerArgs := []string{"run", "--summary-export=" + K6_SUMMARY_PATH}
+	containerArgs = append(containerArgs, args...)
+	if record {
+		containerArgs = append(containerArgs, "-o", "experimental-prometheus-rw")
+	}
+	log.Printf("Container args: %#v", containerArgs)
+	log.Printf("***Running equivalent of:\n %s\n", strings.Join(append([]string{"k6", "run"}, args...), " "))
+	volumeMounts := []any{
+		map[string]any{"mountPath": "/k6", "name": "k6-test-files"},
+		map[string]any{"mountPath": "/k6/lib", "name": "k6-lib-files"},
+	}
+	volumes := []any{
+		map[string]any{"name": "k6-test-files", "configMap": map[string]any{"name": "k6-test-files"}},
+		map[string]any{"name": "k6-lib-files", "configMap": map[string]any{"name": "k6-lib-files"}},
+	}
+	if kubeconfig != "" {
+		volumeMounts = append(volumeMounts, map[string]any{"mountPath": "/kube", "name": "kube"})
+		volumes = append(volumes, map[string]any{"name": "kube", "secret": map[string]any{"secretName": "kube"}})
+	}
+
+	overrides := map[string]any{
+		"apiVersion": "v1",
+		"spec": map[string]any{
+			"containers": []any{
+				map[string]any{
+					"name":  "k6",
+					"image": K6_IMAGE,
+					"stdin": true,
+					"tty":   tty,
+					// the summary is printed after k6 output, see ParseK6Summary
+					"command": []string{"sh", "-c", k6SummaryScript, "k6"},
+					// "run" , envArgs, tagArgs, test, outputArgs
+					"args":       containerArgs,
+					"workingDir": "/",
+					"env": []any{
+						map[string]any{"name": "K6_PROMETHEUS_RW_SERVER_URL", "value": MIMIR_URL + "/api/v1/push"},
+						map[string]any{"name": "K6_PROMETHEUS_RW_TREND_AS_NATIVE_HISTOGRAM", "value": "true"},
+						map[string]any{"name": "K6_PROMETHEUS_RW_STALE_MARKERS", "value": "true"},
+					},
+					"volumeMounts": volumeMounts,
+				},
+			},
+			"volumes": volumes,
+		},
+	}
+	overridesJson, _ := json.Marshal(overrides)
+	// the pod of a previous run may be left behind if soil was killed
+	if err := r.KubeCtl(ctx, cluster, "--namespace=tester", "delete", "pod", name, "--ignore-not-found"); err != nil {
+		return nil, err
+	}
+	// the pod is kept after k6 exits, so that the summary can be read from its logs,
+	// it is deleted even if interrupted, k6 would keep generating load
+	defer func() {
+		err := r.KubeCtl(context.WithoutCancel(ctx), cluster, "--namespace=tester", "delete", "pod", name, "--ignore-not-found")
+		if err != nil {
+			log.Printf("*** Unable to delete k6 pod: %v", err)
+		}
+	}()
+	run := r.KubeCtl
+	if tty {
+		run = r.KubeCtlTty
+	}
+	runErr := run(ctx, cluster, "run", name, "--image", K6_IMAGE, "--namespace=tester",
+		/*
+			EE Unable to use a TTY - input is not a terminal or the right kind of file
+			EE If you don't see a command prompt, try pressing enter.
+			EE warning: couldn't attach to pod/k6, falling back to streaming logs:
+		*/
+		"-i",
+		fmt.Sprintf("--tty=%v", tty),
+		"--restart=Never",
+		fmt.Sprintf("--overrides='%s'", string(overridesJson)))
+	if ctx.Err() != nil {
+		return nil, runErr
+	}
+	logs, err := r.KubeCtlOutput(ctx, cluster, "--namespace=tester", "logs", name)
+	if err != nil {
+		log.Printf("*** Unable to read k6 logs: %v", err)
+	}
+	summary, err := ParseK6Summary(logs)
+	if err != nil {
+		log.Printf("*** %v", err)
+	}
+	return summary, runErr
+}
@@ -0,0 +1,101 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sync"
+)
+
+// FakeResponse is a canned result returned by FakeExecutor for the commands
+// matching the Pattern regular expression.
+type FakeResponse struct {
+	Pattern  *regexp.Regexp
+	Stdout   string
+	ExitCode int
+}
+
+// FakeExitError is returned by FakeExecutor for non-zero exit codes.
+type FakeExitError struct {
+	Command  string
+	ExitCode int
+}
+
+func (e FakeExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.ExitCode)
+}
+
+/**
+ * FakeExecutor records commands instead of running them and replies with
+ * scripted responses, the first response matching the command wins.
+ * Commands not matching any response succeed with empty output.
+ */
+type FakeExecutor struct {
+	Responses []FakeResponse
+	Commands  []string
+	mu        sync.Mutex
+}
+
+func NewFakeExecutor() *FakeExecutor {
+	return &FakeExecutor{}
+}
+
+// On adds a response for commands matching the pattern.
+func (f *FakeExecutor) On(pattern string, stdout string, exitCode int) *FakeExecutor {
+	f.Responses = append(f.Responses, FakeResponse{
+		Pattern:  regexp.MustCompile(pattern),
+		Stdout:   stdout,
+		ExitCode: exitCode,
+	})
+	return f
+}
+
+func (f *FakeExecutor) respond(ctx context.Context, args []string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	cmd := dryRunCommand(args)
+	f.Commands = append(f.Commands, cmd)
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+	for _, r := range f.Responses {
+		if r.Pattern.MatchString(cmd) {
+			if r.ExitCode != 0 {
+				return r.Stdout, FakeExitError{Command: cmd, ExitCode: r.ExitCode}
+			}
+			return r.Stdout, nil
+		}
+	}
+	return "", nil
+}
+
+func (f *FakeExecutor) Run(ctx context.Context, c Ctx, args ...string) (string, error) {
+	return f.respond(ctx, args)
+}
+
+func (f *FakeExecutor) RunTty(ctx context.Context, args ...string) error {
+	_, err := f.respond(ctx, args)
+	return err
+}
+
+func (f *FakeExecutor) Start(ctx context.Context, args ...string) (func(), error) {
+	_, err := f.respond(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	return func() {}, nil
+}
+
+// Matching returns recorded commands matching the pattern.
+func (f *FakeExecutor) Matching(pattern string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	re := regexp.MustCompile(pattern)
+	matched := []string{}
+	for _, cmd := range f.Commands {
+		if re.MatchString(cmd) {
+			matched = append(matched, cmd)
+		}
+	}
+	return matched
+}
@@ -0,0 +1,31 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "status")
+	assert.NoError(t, os.WriteFile(path, []byte("old"), 0644))
+
+	assert.NoError(t, WriteFileAtomic(path, []byte("new"), 0600))
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "new", string(data))
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	items, _ := os.ReadDir(dir)
+	assert.Len(t, items, 1)
+}
+
+func TestWriteFileAtomicNoDir(t *testing.T) {
+	err := WriteFileAtomic(filepath.Join(t.TempDir(), "missing", "status"), []byte("new"), 0644)
+	assert.Error(t, err)
+}
@@ -1,6 +1,7 @@
 package util
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
@@ -28,12 +29,16 @@ func RepoFromRef(ref string) (url string, branch string) {
 }
 
 // CloneGitRepo(d.Repo, d.getRepoLocalPath())
-func CloneGitRepo(ref string, path string) {
+func CloneGitRepo(ctx context.Context, ref string, path string) error {
+	return NewRunner(nil).CloneGitRepo(ctx, ref, path)
+}
+
+func (r Runner) CloneGitRepo(ctx context.Context, ref string, path string) error {
 	// split repo url from ref
 	log.Printf("Checking out repo %s...", ref)
 	url, branch := RepoFromRef(ref)
 	if url == "" {
-		log.Panicf("Invalid repo %s", ref)
+		return fmt.Errorf("Invalid repo %s", ref)
 	}
 	log.Printf("Check if local repo exist by: %s", path)
 	if _, err := os.Stat(path); os.IsNotExist(err) {
@@ -42,16 +47,20 @@ func CloneGitRepo(ref string, path string) {
 		if branch != "" {
 			gitClone = fmt.Sprintf("git clone %s -b %s %s", url, branch, path)
 		}
-		Shell(gitClone)
-
-	} else {
-		log.Printf("Local git repo for %s already exists, skipping...", url)
+		_, err := r.Shell(ctx, gitClone)
+		return err
 	}
+	log.Printf("Local git repo for %s already exists, skipping...", url)
+	return nil
+}
+
+func GetRepoHead(ctx context.Context, localPath string) string {
+	return NewRunner(nil).GetRepoHead(ctx, localPath)
 }
 
-func GetRepoHead(localPath string) string {
-	commit, _ := ShellOutput(
-		fmt.Sprintf("cd %v & git rev-parse --short HEAD", localPath),
+func (r Runner) GetRepoHead(ctx context.Context, localPath string) string {
+	commit, _ := r.ShellOutput(ctx,
+		fmt.Sprintf("git -C %s rev-parse --short HEAD", ShellQuote(localPath)),
 	)
 	return strings.TrimSpace(commit)
 }
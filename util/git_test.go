@@ -1,6 +1,9 @@
 package util
 
 import (
+	"context"
+	"os/exec"
+	"strings"
 	"testing"
 )
 import "github.com/stretchr/testify/assert"
@@ -40,3 +43,19 @@ func TestRepoFromRef(t *testing.T) {
 		assert.Equal(t, c.Bra, bra)
 	}
 }
+
+func TestGetRepoHead(t *testing.T) {
+	path := t.TempDir() + "/some repo"
+	git := func(args ...string) string {
+		args = append([]string{"-C", path, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)
+		out, err := exec.Command("git", args...).CombinedOutput()
+		assert.NoError(t, err, string(out))
+		return strings.TrimSpace(string(out))
+	}
+	assert.NoError(t, exec.Command("git", "init", "-q", path).Run())
+	git("commit", "-q", "--allow-empty", "-m", "initial")
+
+	assert.Equal(t, git("rev-parse", "--short", "HEAD"), GetRepoHead(context.Background(), path))
+	// not a repo, HEAD of the current directory must not leak in
+	assert.Equal(t, "", GetRepoHead(context.Background(), t.TempDir()))
+}
@@ -0,0 +1,186 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// K6_SUMMARY_PATH is where k6 exports the end-of-test summary in the k6 pod.
+const K6_SUMMARY_PATH = "/tmp/summary.json"
+
+// K6_SUMMARY_MARKER separates k6 output from the summary printed after it.
+const K6_SUMMARY_MARKER = "---- k6 summary ----"
+
+// k6SummaryScript runs k6 with the container args and prints the summary
+// after K6_SUMMARY_MARKER, keeping the exit code of k6.
+const k6SummaryScript = `k6 "$@"; rc=$?; echo; echo "` + K6_SUMMARY_MARKER + `"; cat ` + K6_SUMMARY_PATH + `; exit $rc`
+
+// K6Metric is a metric of the k6 summary, Values are the statistics, e.g. avg,
+// p(95), count, rate or value, Thresholds map threshold expressions to failure.
+type K6Metric struct {
+	Values     map[string]float64
+	Thresholds map[string]bool
+}
+
+func (m *K6Metric) UnmarshalJSON(data []byte) error {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	m.Values = map[string]float64{}
+	for k, v := range fields {
+		if k == "thresholds" {
+			if err := json.Unmarshal(v, &m.Thresholds); err != nil {
+				return err
+			}
+			continue
+		}
+		var f float64
+		if json.Unmarshal(v, &f) == nil {
+			m.Values[k] = f
+		}
+	}
+	return nil
+}
+
+// K6Summary is the end-of-test summary exported by `k6 run --summary-export`.
+type K6Summary struct {
+	Metrics map[string]K6Metric `json:"metrics"`
+	// Data is the summary as exported by k6
+	Data []byte `json:"-"`
+}
+
+/**
+ * ParseK6Summary: parse the summary printed after K6_SUMMARY_MARKER in output.
+ *
+ * Returns nil if the output has no summary, e.g. k6 failed to start.
+ */
+func ParseK6Summary(output string) (*K6Summary, error) {
+	i := strings.LastIndex(output, K6_SUMMARY_MARKER)
+	if i < 0 {
+		return nil, nil
+	}
+	data := strings.TrimSpace(strings.ReplaceAll(output[i+len(K6_SUMMARY_MARKER):], "\r\n", "\n"))
+	if data == "" {
+		return nil, nil
+	}
+	return ParseK6SummaryData([]byte(data))
+}
+
+// ParseK6SummaryData parses the summary exported by k6.
+func ParseK6SummaryData(data []byte) (*K6Summary, error) {
+	s := &K6Summary{Data: data}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("Invalid k6 summary: %w", err)
+	}
+	return s, nil
+}
+
+// Value returns the statistic of the metric, 0 if the metric was not recorded.
+func (s *K6Summary) Value(metric string, stat string) float64 {
+	return s.Metrics[metric].Values[stat]
+}
+
+// Checks returns the number of passed and failed checks.
+func (s *K6Summary) Checks() (int, int) {
+	return int(s.Value("checks", "passes")), int(s.Value("checks", "fails"))
+}
+
+// Thresholds returns all thresholds as "metric: expression", sorted.
+func (s *K6Summary) Thresholds() []string {
+	return s.thresholds(func(bool) bool { return true })
+}
+
+// FailedThresholds returns failed thresholds as "metric: expression", sorted.
+func (s *K6Summary) FailedThresholds() []string {
+	return s.thresholds(func(failed bool) bool { return failed })
+}
+
+func (s *K6Summary) thresholds(match func(failed bool) bool) []string {
+	result := []string{}
+	for name, m := range s.Metrics {
+		for expr, failed := range m.Thresholds {
+			if match(failed) {
+				result = append(result, name+": "+expr)
+			}
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+/**
+ * MergeK6Summaries merges summaries of k6 instances running execution
+ * segments of the same test, nil summaries are skipped.
+ *
+ * Counts add up, rates are recomputed from passes and fails, min and max are
+ * kept, averages, medians and percentiles are averaged over the instances,
+ * which approximates them. A threshold fails if it failed in any instance.
+ */
+func MergeK6Summaries(summaries []*K6Summary) *K6Summary {
+	merged := &K6Summary{Metrics: map[string]K6Metric{}}
+	seen := map[string]map[string]int{}
+	for _, s := range summaries {
+		if s == nil {
+			continue
+		}
+		for name, m := range s.Metrics {
+			mm, ok := merged.Metrics[name]
+			if !ok {
+				mm = K6Metric{Values: map[string]float64{}}
+				seen[name] = map[string]int{}
+			}
+			for stat, v := range m.Values {
+				n := seen[name][stat]
+				seen[name][stat] = n + 1
+				old, ok := mm.Values[stat]
+				switch {
+				case !ok:
+					mm.Values[stat] = v
+				case stat == "count" || stat == "passes" || stat == "fails" || stat == "rate":
+					mm.Values[stat] = old + v
+				case stat == "min":
+					mm.Values[stat] = min(old, v)
+				case stat == "max":
+					mm.Values[stat] = max(old, v)
+				default:
+					mm.Values[stat] = (old*float64(n) + v) / float64(n+1)
+				}
+			}
+			for expr, failed := range m.Thresholds {
+				if mm.Thresholds == nil {
+					mm.Thresholds = map[string]bool{}
+				}
+				mm.Thresholds[expr] = mm.Thresholds[expr] || failed
+			}
+			merged.Metrics[name] = mm
+		}
+	}
+	if len(merged.Metrics) == 0 {
+		return nil
+	}
+	for _, m := range merged.Metrics {
+		passes, ok := m.Values["passes"]
+		if fails, ok2 := m.Values["fails"]; ok && ok2 && passes+fails > 0 {
+			if _, ok := m.Values["value"]; ok {
+				// rate metrics, e.g. http_req_failed: passes are non-zero values
+				m.Values["value"] = passes / (passes + fails)
+			}
+		}
+	}
+	merged.Data, _ = json.MarshalIndent(merged, "", "  ")
+	return merged
+}
+
+func (m K6Metric) MarshalJSON() ([]byte, error) {
+	fields := map[string]any{}
+	for k, v := range m.Values {
+		fields[k] = v
+	}
+	if m.Thresholds != nil {
+		fields["thresholds"] = m.Thresholds
+	}
+	return json.Marshal(fields)
+}
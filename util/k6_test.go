@@ -0,0 +1,128 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testK6Output = "running (00m01.0s), 0/1 VUs, 1 complete\r\n\r\n" + K6_SUMMARY_MARKER + "\r\n" + `{
+    "root_group": {"name": "", "checks": {}},
+    "metrics": {
+        "checks": {"passes": 9, "fails": 1, "value": 0.9},
+        "http_req_duration": {"avg": 12.5, "p(95)": 40.25, "thresholds": {"p(95)<30": true, "avg<100": false}},
+        "http_req_failed": {"passes": 0, "fails": 10, "value": 0, "thresholds": {"rate<0.01": false}},
+        "http_reqs": {"count": 10, "rate": 9.8}
+    }
+}`
+
+func TestParseK6Summary(t *testing.T) {
+	s, err := ParseK6Summary(testK6Output)
+	assert.NoError(t, err)
+	assert.NotNil(t, s)
+	passed, failed := s.Checks()
+	assert.Equal(t, 9, passed)
+	assert.Equal(t, 1, failed)
+	assert.Equal(t, 40.25, s.Value("http_req_duration", "p(95)"))
+	assert.Equal(t, 0.0, s.Value("missing", "avg"))
+	assert.Equal(t, []string{"http_req_duration: avg<100", "http_req_duration: p(95)<30", "http_req_failed: rate<0.01"},
+		s.Thresholds())
+	assert.Equal(t, []string{"http_req_duration: p(95)<30"}, s.FailedThresholds())
+	assert.Contains(t, string(s.Data), `"root_group"`)
+}
+
+func TestParseK6SummaryMissing(t *testing.T) {
+	s, err := ParseK6Summary("error: no such file\n")
+	assert.NoError(t, err)
+	assert.Nil(t, s)
+
+	_, err = ParseK6Summary(K6_SUMMARY_MARKER + "\n{broken")
+	assert.Error(t, err)
+}
+
+func TestMergeK6Summaries(t *testing.T) {
+	a, _ := ParseK6SummaryData([]byte(`{"metrics": {
+		"checks": {"passes": 9, "fails": 1, "value": 0.9},
+		"http_req_duration": {"min": 2, "max": 50, "p(95)": 40, "thresholds": {"p(95)<45": false}},
+		"http_req_failed": {"passes": 0, "fails": 10, "value": 0},
+		"http_reqs": {"count": 10, "rate": 10}}}`))
+	b, _ := ParseK6SummaryData([]byte(`{"metrics": {
+		"checks": {"passes": 10, "fails": 0, "value": 1},
+		"http_req_duration": {"min": 1, "max": 60, "p(95)": 50, "thresholds": {"p(95)<45": true}},
+		"http_req_failed": {"passes": 5, "fails": 5, "value": 0.5},
+		"http_reqs": {"count": 10, "rate": 8}}}`))
+	s := MergeK6Summaries([]*K6Summary{a, nil, b})
+	passed, failed := s.Checks()
+	assert.Equal(t, 19, passed)
+	assert.Equal(t, 1, failed)
+	assert.Equal(t, 0.95, s.Value("checks", "value"))
+	assert.Equal(t, 1.0, s.Value("http_req_duration", "min"))
+	assert.Equal(t, 60.0, s.Value("http_req_duration", "max"))
+	assert.Equal(t, 45.0, s.Value("http_req_duration", "p(95)"))
+	assert.Equal(t, 0.25, s.Value("http_req_failed", "value"))
+	assert.Equal(t, 20.0, s.Value("http_reqs", "count"))
+	assert.Equal(t, 18.0, s.Value("http_reqs", "rate"))
+	assert.Equal(t, []string{"http_req_duration: p(95)<45"}, s.FailedThresholds())
+
+	parsed, err := ParseK6SummaryData(s.Data)
+	assert.NoError(t, err)
+	assert.Equal(t, s.Metrics, parsed.Metrics)
+
+	assert.Nil(t, MergeK6Summaries([]*K6Summary{nil, nil}))
+}
+
+// cancelingExecutor cancels the context once all k6 pods run, k6 runs until
+// the context is done like a long test.
+type cancelingExecutor struct {
+	*FakeExecutor
+	cancel  context.CancelFunc
+	pods    int32
+	running atomic.Int32
+}
+
+func (e *cancelingExecutor) Run(ctx context.Context, c Ctx, args ...string) (string, error) {
+	if strings.HasPrefix(args[len(args)-1], "kubectl run ") {
+		if e.running.Add(1) == e.pods {
+			e.cancel()
+		}
+		<-ctx.Done()
+	}
+	return e.FakeExecutor.Run(ctx, c, args...)
+}
+
+func TestK6RunPodsCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	f := NewFakeExecutor()
+	r := NewRunner(&cancelingExecutor{FakeExecutor: f, cancel: cancel, pods: 3})
+	_, err := r.K6RunPods(ctx, ClusterAccess{Kubeconfig: "/tmp/tester.yaml"}, map[string]string{}, nil, "k6/test.js", false, 3)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	for i := 0; i < 3; i++ {
+		// before and after the run
+		assert.Len(t, f.Matching(fmt.Sprintf(`^kubectl --namespace=tester delete pod k6-%d `, i)), 2)
+	}
+	assert.Empty(t, f.Matching(`logs`))
+}
+
+func TestK6RunLocalDocker(t *testing.T) {
+	f := NewFakeExecutor()
+	l := K6Local{Dir: "/tmp/k6", Docker: true, MimirUrl: "http://localhost:9009/mimir"}
+	envs := map[string]string{"KUBECONFIG": "/tmp/upstream.yaml", "BASE_URL": "https://upstream"}
+	summary, err := NewRunner(f).K6RunLocal(context.Background(), l, envs, map[string]string{"run_id": "1"}, "k6/test.js", true)
+	assert.NoError(t, err)
+	assert.Nil(t, summary)
+
+	user := fmt.Sprintf("--user=%d:%d", os.Getuid(), os.Getgid())
+	assert.Len(t, f.Commands, 1)
+	assert.Regexp(t, `^docker run --rm -i --network=host -v '/tmp/k6:/scripts:ro' -w /scripts `+
+		`-v '`+regexp.QuoteMeta(os.TempDir())+`/k6-summary-[0-9]+:/summary' `+user+` -v '/tmp/upstream.yaml:/kube/config:ro' `+
+		`-e 'K6_PROMETHEUS_RW_SERVER_URL=http://localhost:9009/mimir/api/v1/push' .* `+
+		K6_IMAGE+` run --summary-export=/summary/summary.json -e 'BASE_URL=https://upstream' `+
+		`-e 'KUBECONFIG=/kube/config' --tag 'run_id=1' k6/test.js -o experimental-prometheus-rw$`, f.Commands[0])
+}
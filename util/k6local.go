@@ -0,0 +1,120 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Runners of k6, K6RunnerPod runs k6 by kubectl run in the tester cluster.
+const (
+	K6RunnerPod    = "pod"
+	K6RunnerLocal  = "local"
+	K6RunnerDocker = "docker"
+)
+
+// K6Runners lists all runners of k6.
+var K6Runners = []string{K6RunnerPod, K6RunnerLocal, K6RunnerDocker}
+
+// K6Local configures k6 running on the local host.
+type K6Local struct {
+	// Dir is the directory test scripts are relative to
+	Dir string
+	// Docker runs k6 in a container instead of the k6 binary
+	Docker bool
+	// MimirUrl receives k6 metrics of recorded tests, e.g. port-forwarded mimir
+	MimirUrl string
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+/**
+ * K6RunLocal runs a k6 script with the k6 binary or in a docker container on the
+ * local host, with the same envs and tags as K6Run. Metrics are sent to
+ * l.MimirUrl if record is set.
+ *
+ * A KUBECONFIG env refers to a local file, it is mounted to the container.
+ */
+func (r Runner) K6RunLocal(ctx context.Context, l K6Local, envs map[string]string, tags map[string]string, test string, record bool) (*K6Summary, error) {
+	summaryDir, err := os.MkdirTemp("", "k6-summary-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(summaryDir)
+	summaryPath := filepath.Join(summaryDir, "summary.json")
+
+	rwEnvs := map[string]string{}
+	if record && l.MimirUrl != "" {
+		rwEnvs["K6_PROMETHEUS_RW_SERVER_URL"] = l.MimirUrl + "/api/v1/push"
+		rwEnvs["K6_PROMETHEUS_RW_TREND_AS_NATIVE_HISTOGRAM"] = "true"
+		rwEnvs["K6_PROMETHEUS_RW_STALE_MARKERS"] = "true"
+	}
+	cmd := []string{}
+	if l.Docker {
+		cmd = append(cmd, "docker", "run", "--rm", "-i", "--network=host",
+			"-v", ShellQuote(l.Dir+":/scripts:ro"), "-w", "/scripts",
+			"-v", ShellQuote(summaryDir+":/summary"))
+		// the image runs as user k6, which can read neither the private summary
+		// dir nor the kubeconfig
+		if uid, gid := os.Getuid(), os.Getgid(); uid >= 0 {
+			cmd = append(cmd, fmt.Sprintf("--user=%d:%d", uid, gid))
+		}
+		if kubeconfig, ok := envs["KUBECONFIG"]; ok {
+			cmd = append(cmd, "-v", ShellQuote(kubeconfig+":/kube/config:ro"))
+			envs["KUBECONFIG"] = "/kube/config"
+		}
+		for _, k := range sortedKeys(rwEnvs) {
+			cmd = append(cmd, "-e", ShellQuote(k+"="+rwEnvs[k]))
+		}
+		cmd = append(cmd, K6_IMAGE, "run", "--summary-export=/summary/summary.json")
+	} else {
+		cmd = append(cmd, "cd", ShellQuote(l.Dir), "&&")
+		for _, k := range sortedKeys(rwEnvs) {
+			cmd = append(cmd, ShellQuote(k+"="+rwEnvs[k]))
+		}
+		cmd = append(cmd, "k6", "run", "--summary-export="+ShellQuote(summaryPath))
+	}
+	for _, k := range sortedKeys(envs) {
+		cmd = append(cmd, "-e", ShellQuote(k+"="+envs[k]))
+	}
+	for _, k := range sortedKeys(tags) {
+		cmd = append(cmd, "--tag", ShellQuote(k+"="+tags[k]))
+	}
+	cmd = append(cmd, test)
+	if record && l.MimirUrl != "" {
+		cmd = append(cmd, "-o", "experimental-prometheus-rw")
+	}
+	cmdStr := strings.Join(cmd, " ")
+	log.Printf("*** Running command: %s", cmdStr)
+	runErr := r.Executor.RunTty(ctx, "bash", "-c", cmdStr)
+
+	data, err := os.ReadFile(summaryPath)
+	if os.IsNotExist(err) {
+		log.Printf("*** k6 summary not found: %s", summaryPath)
+		return nil, runErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read k6 summary: %w", err)
+	}
+	summary, err := ParseK6SummaryData(data)
+	if err != nil {
+		log.Printf("*** %v", err)
+	}
+	return summary, runErr
+}
+
+// KubeApiServer returns the URL of the kubernetes API server of the cluster.
+func (r Runner) KubeApiServer(ctx context.Context, cluster ClusterAccess) (string, error) {
+	return r.KubeCtlOutput(ctx, cluster, "config", "view", "--minify", "-o", "jsonpath='{.clusters[0].cluster.server}'")
+}
@@ -0,0 +1,15 @@
+package util
+
+import (
+	"net"
+)
+
+// FreePort returns a local TCP port which is not in use.
+func FreePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
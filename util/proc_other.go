@@ -0,0 +1,27 @@
+//go:build !unix
+
+package util
+
+import (
+	"os"
+	"os/exec"
+)
+
+type processGroup struct{}
+
+func setProcessGroup(cmd *exec.Cmd) *processGroup {
+	return &processGroup{}
+}
+
+func (g *processGroup) exited() {
+}
+
+// ProcessAlive reports whether a process with the pid exists.
+func ProcessAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
@@ -0,0 +1,54 @@
+//go:build unix
+
+package util
+
+import (
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// processGroup of a command, the group is killed if it does not exit in
+// TERMINATION_GRACE after cancellation.
+type processGroup struct {
+	mu   sync.Mutex
+	kill *time.Timer
+	done bool
+}
+
+// setProcessGroup starts the command in its own process group, so that
+// cancellation terminates the command together with all its children.
+// exited must be called once the command is waited for.
+func setProcessGroup(cmd *exec.Cmd) *processGroup {
+	g := &processGroup{}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		pgid := -cmd.Process.Pid
+		g.mu.Lock()
+		if !g.done {
+			g.kill = time.AfterFunc(TERMINATION_GRACE, func() {
+				syscall.Kill(pgid, syscall.SIGKILL)
+			})
+		}
+		g.mu.Unlock()
+		return syscall.Kill(pgid, syscall.SIGTERM)
+	}
+	return g
+}
+
+// exited stops the pending kill, the pgid may be reused after the command exits.
+func (g *processGroup) exited() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.done = true
+	if g.kill != nil {
+		g.kill.Stop()
+	}
+}
+
+// ProcessAlive reports whether a process with the pid exists.
+func ProcessAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
@@ -0,0 +1,28 @@
+//go:build unix
+
+package util
+
+import (
+	"context"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessGroupExitsOnTerm(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd := exec.CommandContext(ctx, "sleep", "10")
+	g := setProcessGroup(cmd)
+	assert.NoError(t, cmd.Start())
+	start := time.Now()
+	cancel()
+	assert.Error(t, cmd.Wait())
+	g.exited()
+	assert.Less(t, time.Since(start), TERMINATION_GRACE)
+
+	// sleep exited on SIGTERM, the pgid must not be killed later
+	assert.NotNil(t, g.kill)
+	assert.False(t, g.kill.Stop())
+}
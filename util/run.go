@@ -3,16 +3,22 @@ package util
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	_ "errors"
 	"fmt"
 	"log"
-	"os"
 	"os/exec"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 )
 
+// TERMINATION_GRACE is time given to a cancelled command to exit after
+// termination signal before it gets killed.
+const TERMINATION_GRACE = 30 * time.Second
+
 func run(args []string) (output string) {
 	cmd := exec.Command(args[0], args[1:]...)
 	data, _ := cmd.CombinedOutput()
@@ -85,8 +91,20 @@ func NewRun() *Ctx {
 	return c
 }
 
-func (c Ctx) execLogging(args ...string) (string, error) {
-	cmd := exec.Command(args[0], args[1:]...)
+// DryRun makes execution helpers print commands instead of running them.
+var DryRun bool
+
+func dryRunCommand(args []string) string {
+	if len(args) == 3 && args[0] == "bash" && args[1] == "-c" {
+		return args[2]
+	}
+	return strings.Join(args, " ")
+}
+
+func (c Ctx) execLogging(ctx context.Context, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	group := setProcessGroup(cmd)
+	cmd.WaitDelay = TERMINATION_GRACE + time.Second
 	o, _ := cmd.StdoutPipe()
 	e, _ := cmd.StderrPipe()
 
@@ -130,241 +148,87 @@ func (c Ctx) execLogging(args ...string) (string, error) {
 	wg.Wait()
 
 	err := cmd.Wait()
+	group.exited()
 	if err != nil {
 		log.Printf("*** Command returns: %v", err)
 	}
 	return output, err
 }
 
-func Exec(args ...string) (string, error) {
-	cmdStr := strings.Join(args, " ")
-	log.Printf("*** Running command: %s", cmdStr)
-	run := NewRun()
-	run.Capture.Stdout = false
-	return run.execLogging("bash", "-c", cmdStr)
+func Exec(ctx context.Context, args ...string) (string, error) {
+	return NewRunner(nil).Exec(ctx, args...)
 }
 
-func ExecTty(args ...string) error {
-	cmdStr := strings.Join(args, " ")
-	log.Printf("*** Running command: %s", cmdStr)
-	cmd := exec.Command("bash", "-c", cmdStr)
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	err := cmd.Run()
-	if err != nil {
-		log.Printf("*** Command returns: %v", err)
-	}
-	return err
+func ExecTty(ctx context.Context, args ...string) error {
+	return NewRunner(nil).ExecTty(ctx, args...)
 }
 
-func ExecOutput(args ...string) (string, error) {
-	cmdStr := strings.Join(args, " ")
-	log.Printf("Running command: %s", cmdStr)
-	run := NewRun()
-	return run.execLogging("bash", "-c", cmdStr)
+func ExecOutput(ctx context.Context, args ...string) (string, error) {
+	return NewRunner(nil).ExecOutput(ctx, args...)
 }
 
-func ExecUnmarshalJson(args ...string) (map[string]any, error) {
-	cmdStr := strings.Join(args, " ")
-	log.Printf("Running command: %s", cmdStr)
-	run := NewRun()
-	output, err := run.execLogging("bash", "-c", cmdStr)
-	var result map[string]any
-	json.Unmarshal([]byte(output), &result)
-	return result, err
+func ExecUnmarshalJson(ctx context.Context, args ...string) (map[string]any, error) {
+	return NewRunner(nil).ExecUnmarshalJson(ctx, args...)
 }
 
-func ExecQuietUnmarshalJson(args ...string) (map[string]any, error) {
-	cmdStr := strings.Join(args, " ")
-	log.Printf("Running command: %s", cmdStr)
-	run := NewRun()
-	run.Logging.Stdout = false
-	output, err := run.execLogging("bash", "-c", cmdStr)
-	var result map[string]any
-	json.Unmarshal([]byte(output), &result)
-	return result, err
+func ExecQuietUnmarshalJson(ctx context.Context, args ...string) (map[string]any, error) {
+	return NewRunner(nil).ExecQuietUnmarshalJson(ctx, args...)
 }
 
-func Shell(cmd string) (string, error) {
-	run := NewRun()
-	run.Capture.Stdout = false
-	log.Printf("Running command: %s", cmd)
-	return run.execLogging("bash", "-c", cmd)
+func Shell(ctx context.Context, cmd string) (string, error) {
+	return NewRunner(nil).Shell(ctx, cmd)
 }
 
-func ShellUnmarshalJson(cmd string) (map[string]any, error) {
-	log.Printf("Running command: %s", cmd)
-	run := NewRun()
-	output, err := run.execLogging("bash", "-c", cmd)
-	var result map[string]any
-	json.Unmarshal([]byte(output), &result)
-	return result, err
+func ShellUnmarshalJson(ctx context.Context, cmd string) (map[string]any, error) {
+	return NewRunner(nil).ShellUnmarshalJson(ctx, cmd)
 }
 
-func ShellQuietUnmarshalJson(cmd string) (map[string]any, error) {
-	run := NewRun()
-	run.Logging.Stderr = false
-	run.Logging.Stdout = false
-	output, err := run.execLogging("bash", "-c", cmd)
-	var result map[string]any
-	json.Unmarshal([]byte(output), &result)
-	return result, err
+func ShellQuietUnmarshalJson(ctx context.Context, cmd string) (map[string]any, error) {
+	return NewRunner(nil).ShellQuietUnmarshalJson(ctx, cmd)
 }
 
-func ShellCombined(cmd string) (string, error) {
-	run := NewRun()
-	run.Capture.Stderr = true
-	log.Printf("Running command: %s", cmd)
-	return run.execLogging("bash", "-c", cmd)
+func ShellCombined(ctx context.Context, cmd string) (string, error) {
+	return NewRunner(nil).ShellCombined(ctx, cmd)
 }
 
-func ShellOutput(cmd string) (string, error) {
-	run := NewRun()
-	return run.execLogging("bash", "-c", cmd)
+func ShellOutput(ctx context.Context, cmd string) (string, error) {
+	return NewRunner(nil).ShellOutput(ctx, cmd)
 }
 
-func ShellQuietOutput(cmd string) (string, error) {
-	run := NewRun()
-	run.Logging.Stdout = false
-	return run.execLogging("bash", "-c", cmd)
+func ShellQuietOutput(ctx context.Context, cmd string) (string, error) {
+	return NewRunner(nil).ShellQuietOutput(ctx, cmd)
 }
 
 func HelmJson(values map[string]any) string {
 	var keyvalues []string
-	for k, v := range values {
-		j, _ := json.Marshal(v)
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		j, _ := json.Marshal(values[k])
 
 		keyvalues = append(keyvalues, fmt.Sprintf("%s=%s", k, j))
 	}
 	return strings.Join(keyvalues, ",")
 }
-func HelmInstall(name string, chart string, cluster map[string]any, namespace string, values map[string]any) {
-	//log.Printf("json %#v", values)
-	args := []string{
-		"helm",
-		"--kubeconfig=" + cluster["kubeconfig"].(string),
-		"--kube-context=" + cluster["context"].(string),
-		"upgrade", "--install",
-		"--namespace=" + namespace,
-		name, chart,
-		"--create-namespace",
-	}
-	if values != nil {
-		args = append(args, "--set-json='"+HelmJson(values)+"'")
-	}
-	Exec(args...)
+
+func HelmInstall(ctx context.Context, name string, chart string, cluster ClusterAccess, namespace string, values map[string]any) error {
+	return NewRunner(nil).HelmInstall(ctx, name, chart, cluster, namespace, values)
 }
 
-/**
- * Runs a k6 script from inside the specified k8s cluster via kubectl run.
- * Specify envs, tags, and a test file from the k6/ dir (which will be transferred via ConfigMaps).
- * Set record = true for result metrics to be sent to Mimir, which is expected to be running in the same cluster.
- *
- * If the test script exercises the Kubernetes API, specify a KUBECONFIG env, the corresponding file will be transferred
- * to the cluster via a Secret.
- */
-func KubeCtl(cluster map[string]any, args ...string) {
-	a := []string{
-		"kubectl",
-	}
-	a = append(a, args...)
-	a = append(a,
-		"--kubeconfig="+cluster["kubeconfig"].(string),
-		"--context="+cluster["context"].(string),
-	)
-	Exec(a...)
+func KubeCtl(ctx context.Context, cluster ClusterAccess, args ...string) error {
+	return NewRunner(nil).KubeCtl(ctx, cluster, args...)
 }
-func KubeCtlTty(cluster map[string]any, args ...string) {
-	a := []string{
-		"kubectl",
-	}
-	a = append(a, args...)
-	a = append(a,
-		"--kubeconfig="+cluster["kubeconfig"].(string),
-		"--context="+cluster["context"].(string),
-	)
-	ExecTty(a...)
+
+func KubeCtlTty(ctx context.Context, cluster ClusterAccess, args ...string) error {
+	return NewRunner(nil).KubeCtlTty(ctx, cluster, args...)
 }
 
 const MIMIR_URL = "http://mimir.tester:9009/mimir"
 const K6_IMAGE = "grafana/k6:0.46.0"
 
-func K6Run(cluster map[string]any, envs map[string]string, tags map[string]string, test string, record bool, tty bool) {
-
-	kubeconfig, ok := envs["KUBECONFIG"]
-	if ok {
-		KubeCtl(cluster, "--namespace=tester", "delete", "secret", "kube", "--ignore-not-found")
-		KubeCtl(cluster, "--namespace=tester", "create", "secret", "generic", "kube",
-			"--from-file=config="+kubeconfig)
-		envs["KUBECONFIG"] = "/kube/config"
-	}
-	log.Printf("k6 env=%#v", envs)
-	cmdArgs := []string{"k6"}
-	args := []string{"run"}
-	for k, v := range envs {
-		args = append(args, "-e", fmt.Sprintf("%s=%s", k, v))
-	}
-	if tags != nil {
-		for k, v := range tags {
-			args = append(args, "--tag", fmt.Sprintf("%s=%s", k, v))
-		}
-	}
-	args = append(args, test)
-
-	containerArgs := []string{}
-	containerArgs = append(containerArgs, args...)
-	if record {
-		containerArgs = append(containerArgs, "-o", "experimental-prometheus-rw")
-	}
-	log.Printf("Container args: %#v", containerArgs)
-	log.Printf("***Running equivalent of:\n %s\n", strings.Join(append(cmdArgs, args...), " "))
-	volumeMounts := []any{
-		map[string]any{"mountPath": "/k6", "name": "k6-test-files"},
-		map[string]any{"mountPath": "/k6/lib", "name": "k6-lib-files"},
-	}
-	volumes := []any{
-		map[string]any{"name": "k6-test-files", "configMap": map[string]any{"name": "k6-test-files"}},
-		map[string]any{"name": "k6-lib-files", "configMap": map[string]any{"name": "k6-lib-files"}},
-	}
-	if kubeconfig != "" {
-		volumeMounts = append(volumeMounts, map[string]any{"mountPath": "/kube", "name": "kube"})
-		volumes = append(volumes, map[string]any{"name": "kube", "secret": map[string]any{"secretName": "kube"}})
-	}
-
-	overrides := map[string]any{
-		"apiVersion": "v1",
-		"spec": map[string]any{
-			"containers": []any{
-				map[string]any{
-					"name":  "k6",
-					"image": K6_IMAGE,
-					"stdin": true,
-					"tty":   tty,
-					// "run" , envArgs, tagArgs, test, outputArgs
-					"args":       containerArgs,
-					"workingDir": "/",
-					"env": []any{
-						map[string]any{"name": "K6_PROMETHEUS_RW_SERVER_URL", "value": MIMIR_URL + "/api/v1/push"},
-						map[string]any{"name": "K6_PROMETHEUS_RW_TREND_AS_NATIVE_HISTOGRAM", "value": "true"},
-						map[string]any{"name": "K6_PROMETHEUS_RW_STALE_MARKERS", "value": "true"},
-					},
-					"volumeMounts": volumeMounts,
-				},
-			},
-			"volumes": volumes,
-		},
-	}
-	overridesJson, _ := json.Marshal(overrides)
-	KubeCtlTty(cluster, "run", "k6", "--image", K6_IMAGE, "--namespace=tester",
-		"--rm",
-		/*
-			EE Unable to use a TTY - input is not a terminal or the right kind of file
-			EE If you don't see a command prompt, try pressing enter.
-			EE warning: couldn't attach to pod/k6, falling back to streaming logs:
-		*/
-		"-i",
-		fmt.Sprintf("--tty=%v", tty),
-		"--restart=Never",
-		fmt.Sprintf("--overrides='%s'", string(overridesJson)))
+func K6Run(ctx context.Context, cluster ClusterAccess, envs map[string]string, tags map[string]string, test string, record bool, tty bool) (*K6Summary, error) {
+	return NewRunner(nil).K6Run(ctx, cluster, envs, tags, test, record, tty)
 }
@@ -1,25 +1,27 @@
 package util
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 )
 
 func TestHelloWorld(t *testing.T) {
 	message := "Hello World"
-	output, _ := ExecOutput("echo", "-n", message)
+	output, _ := ExecOutput(context.Background(), "echo", "-n", message)
 	assert.Equal(t, message, output)
 }
 
 func TestEmptyLine(t *testing.T) {
-	output, _ := ExecOutput("echo", "-n", "")
+	output, _ := ExecOutput(context.Background(), "echo", "-n", "")
 	assert.Equal(t, "", output)
 }
 
 func TestEmptyLineN(t *testing.T) {
-	output, _ := ExecOutput("echo", "")
+	output, _ := ExecOutput(context.Background(), "echo", "")
 	assert.Equal(t, "\n", output)
 }
 
@@ -33,7 +35,7 @@ func TestMultiLineScript(t *testing.T) {
                echo Err4 1>&2
                sleep 0.01
                echo Out5`
-	output, _ := ShellCombined(script)
+	output, _ := ShellCombined(context.Background(), script)
 	assert.NotEmpty(t, output)
 	expected := "Err1\nOut2\nOut3\nErr4\nOut5\n"
 	assert.Equal(t, expected, output)
@@ -41,9 +43,9 @@ func TestMultiLineScript(t *testing.T) {
 
 func TestDefer(t *testing.T) {
 	for i := 0; i < 3; i++ {
-		defer Shell(fmt.Sprintf("echo %d", i))
+		defer Shell(context.Background(), fmt.Sprintf("echo %d", i))
 	}
-	Shell("echo hello")
+	Shell(context.Background(), "echo hello")
 }
 
 func TestHelmJson(t *testing.T) {
@@ -163,3 +165,22 @@ func TestHelmInstall(t *testing.T) {
 	fmt.Printf("graphana json: %s", HelmJson(graphanaJson))
 	//HelmInstall("Name", "Chart", graphanaCluster, "NameSpace", graphanaJson)
 }
+
+func TestDryRun(t *testing.T) {
+	DryRun = true
+	defer func() { DryRun = false }()
+	output, err := ExecOutput(context.Background(), "echo", "-n", "Hello")
+	assert.NoError(t, err)
+	assert.Equal(t, "", output)
+	assert.Equal(t, "echo -n Hello", dryRunCommand([]string{"bash", "-c", "echo -n Hello"}))
+}
+
+func TestCancel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	output, err := ShellOutput(ctx, "sleep 10 & wait; echo done")
+	assert.Error(t, err)
+	assert.Equal(t, "", output)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
@@ -10,3 +10,8 @@ func SplitLast(s, sep string) (last string) {
 	}
 	return s
 }
+
+// ShellQuote quotes s as a single argument of a shell command.
+func ShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,12 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShellQuote(t *testing.T) {
+	assert.Equal(t, `'sum(x{a="b"})'`, ShellQuote(`sum(x{a="b"})`))
+	assert.Equal(t, `'it'\''s'`, ShellQuote(`it's`))
+}